@@ -8,7 +8,13 @@ import (
 	"os"
 
 	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/downloader"
 	"github.com/gautch29/downloader-backend/internal/handler"
+	// Hosters register themselves with the integration registry.
+	_ "github.com/gautch29/downloader-backend/internal/integration/direct"
+	_ "github.com/gautch29/downloader-backend/internal/integration/ftp"
+	_ "github.com/gautch29/downloader-backend/internal/integration/onefichier"
+	_ "github.com/gautch29/downloader-backend/internal/integration/sftp"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -56,6 +62,9 @@ func main() {
 		return
 	}
 
+	// Start Download Engine
+	downloader.Start(context.Background())
+
 	// Setup Router
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -65,7 +74,7 @@ func main() {
 	// Adjust AllowedOrigins to matches your frontend's URL for better security.
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"}, // Allow all origins for now (adjust for production)
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
@@ -87,11 +96,33 @@ func main() {
 
 		r.Get("/downloads", handler.ListDownloads)
 		r.Post("/downloads", handler.AddDownload)
+		r.Post("/downloads/inspect", handler.InspectDownload)
+		r.Put("/downloads/queue", handler.ReorderQueue)
+		r.Patch("/downloads/{id}", handler.UpdateDownload)
 		r.Delete("/downloads/{id}", handler.DeleteDownload)
+		r.Post("/downloads/{id}/move", handler.MoveDownload)
+		r.Post("/downloads/{id}/pause", handler.PauseDownload)
+		r.Post("/downloads/{id}/resume", handler.ResumeDownload)
+		r.Post("/downloads/{id}/cancel", handler.CancelDownload)
+		r.Post("/downloads/{id}/retry", handler.RetryDownload)
+
+		r.Get("/packages", handler.ListPackages)
+		r.Delete("/packages/{id}", handler.DeletePackage)
+
+		r.Get("/search", handler.Search)
+		r.Get("/search/release", handler.GetRelease)
+		r.Post("/search/release/queue", handler.QueueRelease)
+		r.Post("/search/release/season", handler.QueueSeason)
 
 		r.Get("/settings", handler.GetSettings)
 		r.Put("/settings", handler.UpdateSettings)
 
+		r.Get("/accounts/1fichier", handler.GetOneFichierAccount)
+		r.Get("/credentials", handler.ListCredentials)
+		r.Post("/credentials", handler.SaveCredential)
+		r.Delete("/credentials/{id}", handler.DeleteCredential)
+		r.Get("/onefichier/files", handler.ListOneFichierFiles)
+
 		r.Get("/diagnostics", handler.RunDiagnostics)
 	})
 
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gautch29/downloader-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// FindCredential returns the saved credential for a protocol and a URL host ("host" or
+// "host:port"). A credential saved for host:port wins over one saved for the bare hostname.
+// It returns nil when there is none.
+func FindCredential(ctx context.Context, protocol, host, hostname string) (*model.Credential, error) {
+	var c model.Credential
+	err := Pool.QueryRow(ctx, `
+		SELECT id, protocol, host, username, password, private_key, host_key, created_at
+		FROM credentials
+		WHERE protocol=$1 AND host IN ($2, $3)
+		ORDER BY host=$2 DESC
+		LIMIT 1`, protocol, host, hostname,
+	).Scan(&c.ID, &c.Protocol, &c.Host, &c.Username, &c.Password, &c.PrivateKey, &c.HostKey, &c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// PinHostKey records key as the host key of a protocol and host when none is saved yet,
+// creating the credential row when there is none, and returns the key saved for the host
+// afterwards: key itself, or the one pinned earlier.
+func PinHostKey(ctx context.Context, protocol, host, key string) (string, error) {
+	var pinned string
+	err := Pool.QueryRow(ctx, `
+		INSERT INTO credentials (protocol, host, host_key) VALUES ($1, $2, $3)
+		ON CONFLICT (protocol, host) DO UPDATE SET host_key=EXCLUDED.host_key WHERE credentials.host_key=''
+		RETURNING host_key`, protocol, host, key,
+	).Scan(&pinned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = Pool.QueryRow(ctx, "SELECT host_key FROM credentials WHERE protocol=$1 AND host=$2", protocol, host).Scan(&pinned)
+	}
+	return pinned, err
+}
+
+// CredentialHosts returns the hosts credentials are saved for under a protocol.
+func CredentialHosts(ctx context.Context, protocol string) ([]string, error) {
+	rows, err := Pool.Query(ctx, "SELECT host FROM credentials WHERE protocol=$1 ORDER BY host", protocol)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hosts []string
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, rows.Err()
+}
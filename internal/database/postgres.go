@@ -62,6 +62,42 @@ func Migrate() error {
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 			updated_at TIMESTAMP WITH TIME ZONE
 		);`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS downloaded BIGINT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS segments INTEGER NOT NULL DEFAULT 1;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS speed_limit BIGINT;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS error_code TEXT;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS start_at TIMESTAMP WITH TIME ZONE;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS checksum TEXT;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS file_hash TEXT;`,
+		`CREATE INDEX IF NOT EXISTS downloads_file_hash_idx ON downloads (file_hash);`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS password TEXT;`,
+		// sort_order defaults to the creation time (FIFO) and is rewritten when the queue is reordered by hand
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS sort_order DOUBLE PRECISION;`,
+		`UPDATE downloads SET sort_order = EXTRACT(EPOCH FROM created_at) WHERE sort_order IS NULL;`,
+		`ALTER TABLE downloads ALTER COLUMN sort_order SET DEFAULT EXTRACT(EPOCH FROM NOW());`,
+		// packages group the downloads queued together from a folder or a list of parts
+		`CREATE TABLE IF NOT EXISTS packages (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS package_id INTEGER REFERENCES packages(id) ON DELETE CASCADE;`,
+		`CREATE INDEX IF NOT EXISTS downloads_package_id_idx ON downloads (package_id);`,
+		// destination is "local" (the default) or "onefichier" for a remote upload into the account
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS destination TEXT NOT NULL DEFAULT 'local';`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS remote_folder_id INTEGER;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS remote_id INTEGER;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS headers JSONB;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS cookies JSONB;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS auth_username TEXT;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS auth_password TEXT;`,
+		// show, season and episode identify an episode of a series, for filing it in Plex
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS show TEXT;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS season INTEGER;`,
+		`ALTER TABLE downloads ADD COLUMN IF NOT EXISTS episode INTEGER;`,
 		`CREATE TABLE IF NOT EXISTS sessions (
 			id SERIAL PRIMARY KEY,
 			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -72,6 +108,24 @@ func Migrate() error {
 			key TEXT PRIMARY KEY,
 			value TEXT NOT NULL
 		);`,
+		// Pages fetched by the Zone-Telechargement scraper, when its cache is persisted
+		`CREATE TABLE IF NOT EXISTS scraper_cache (
+			url TEXT PRIMARY KEY,
+			final_url TEXT NOT NULL,
+			body BYTEA NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS credentials (
+			id SERIAL PRIMARY KEY,
+			protocol TEXT NOT NULL,
+			host TEXT NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			password TEXT NOT NULL DEFAULT '',
+			private_key TEXT NOT NULL DEFAULT '',
+			host_key TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE (protocol, host)
+		);`,
 		`CREATE TABLE IF NOT EXISTS paths (
 			id SERIAL PRIMARY KEY,
 			name TEXT NOT NULL,
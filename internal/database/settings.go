@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+)
+
+// GetSettings returns the stored values for the given keys. Keys that have never been saved are absent from the map.
+func GetSettings(ctx context.Context, keys ...string) (map[string]string, error) {
+	rows, err := Pool.Query(ctx, "SELECT key, value FROM settings WHERE key = ANY($1)", keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
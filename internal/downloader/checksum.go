@@ -0,0 +1,126 @@
+package downloader
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jzelinskie/whirlpool"
+)
+
+// CodeChecksumMismatch is the error code of a download whose content does not match its expected checksum.
+const CodeChecksumMismatch = "checksum_mismatch"
+
+// fileHashAlgo is the algorithm of the hash stored for every completed download, used to spot duplicates.
+const fileHashAlgo = "sha256"
+
+var hashConstructors = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	// 1fichier publishes Whirlpool checksums
+	"whirlpool": whirlpool.New,
+}
+
+// ParseChecksum normalizes an expected checksum to "algo:hex". It accepts "algo:hex" or a bare
+// hex digest, whose algorithm is inferred from its length (128 characters is taken as SHA-512;
+// Whirlpool digests must be prefixed).
+func ParseChecksum(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	algo, digest, found := strings.Cut(value, ":")
+	if !found {
+		digest = value
+		switch len(digest) {
+		case 32:
+			algo = "md5"
+		case 40:
+			algo = "sha1"
+		case 64:
+			algo = "sha256"
+		case 128:
+			algo = "sha512"
+		default:
+			return "", fmt.Errorf("cannot infer the algorithm of a %d-character checksum", len(digest))
+		}
+	}
+	newHash, ok := hashConstructors[algo]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != newHash().Size()*2 {
+		return "", fmt.Errorf("invalid %s checksum", algo)
+	}
+	return algo + ":" + digest, nil
+}
+
+// fileHasher computes the stored file hash, plus the expected checksum's algorithm when it differs,
+// in a single pass over the data.
+type fileHasher struct {
+	hashes map[string]hash.Hash
+	n      int64 // bytes hashed so far
+}
+
+func newFileHasher(expected string) *fileHasher {
+	h := &fileHasher{hashes: map[string]hash.Hash{fileHashAlgo: hashConstructors[fileHashAlgo]()}}
+	if algo, _, ok := strings.Cut(expected, ":"); ok {
+		if newHash, ok := hashConstructors[algo]; ok && algo != fileHashAlgo {
+			h.hashes[algo] = newHash()
+		}
+	}
+	return h
+}
+
+func (h *fileHasher) Write(p []byte) (int, error) {
+	for _, hh := range h.hashes {
+		hh.Write(p)
+	}
+	h.n += int64(len(p))
+	return len(p), nil
+}
+
+// syncTo makes the hasher cover exactly the first size bytes of the file at path, re-reading
+// it when the data was not streamed through the hasher (resumed or segmented transfers).
+func (h *fileHasher) syncTo(path string, size int64) error {
+	if h.n == size {
+		return nil
+	}
+	for _, hh := range h.hashes {
+		hh.Reset()
+	}
+	h.n = 0
+	if size == 0 {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(h, f, size)
+	return err
+}
+
+func (h *fileHasher) sum(algo string) string {
+	return algo + ":" + hex.EncodeToString(h.hashes[algo].Sum(nil))
+}
+
+// verify compares the data hashed so far with an expected "algo:hex" checksum.
+func (h *fileHasher) verify(expected string) error {
+	algo, _, _ := strings.Cut(expected, ":")
+	if _, ok := h.hashes[algo]; !ok {
+		return nil
+	}
+	if got := h.sum(algo); got != expected {
+		return permanentError(CodeChecksumMismatch, fmt.Errorf("checksum mismatch: expected %s, got %s", expected, got))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// stopTimeout bounds how long Stop waits for a worker to notice its cancellation.
+const stopTimeout = 10 * time.Second
+
+// errStopped is the cancellation cause given to a worker whose download was paused, cancelled or deleted.
+// The row's new status has already been written by whoever stopped it.
+var errStopped = errors.New("stopped by user")
+
+// WaitingStatuses are the statuses of rows waiting in the queue for a free slot.
+var WaitingStatuses = []string{string(model.StatusPending), string(model.StatusQueued)}
+
+// QueueOrder is the ORDER BY clause giving the order in which waiting rows are started:
+// highest priority first, then by sort_order, which defaults to the creation time and is
+// rewritten when the queue is reordered by hand.
+const QueueOrder = "priority DESC, sort_order, id"
+
+// job is a transfer currently owned by a worker.
+type job struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// Stop interrupts the Default manager's transfer of a download, if one is running.
+func Stop(id int) {
+	if Default != nil {
+		Default.Stop(id)
+	}
+}
+
+// Stop cancels the running transfer of a download and waits for its worker to let go of the
+// files. It is a no-op when the download is not running.
+func (m *Manager) Stop(id int) {
+	m.mu.Lock()
+	j, ok := m.running[id]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	j.cancel(errStopped)
+	select {
+	case <-j.done:
+	case <-time.After(stopTimeout):
+	}
+}
+
+// RemoveFiles deletes the partial data of a download and, when includeCompleted is set,
+// the finished file as well. Missing files are not an error. Only files the download wrote
+// are removed (see ownsFiles): a download that never started, or a remote upload, has none,
+// and the files under its name belong to another download.
+func RemoveFiles(dl *model.Download, includeCompleted bool) error {
+	if dl.Destination == model.DestinationOneFichier {
+		return nil
+	}
+	name := knownFilename(dl)
+	if name == "" || !ownsFiles(dl, name) {
+		return nil
+	}
+	dest := filepath.Join(targetDir(dl), name)
+
+	paths := []string{dest + partSuffix, dest + segmentsSuffix}
+	if includeCompleted {
+		paths = append(paths, dest)
+	}
+	var errs []error
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
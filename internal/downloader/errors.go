@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes stored in downloads.error_code.
+const (
+	CodeInvalidURL  = "invalid_url"
+	CodeNotFound    = "not_found"
+	CodeForbidden   = "forbidden"
+	CodeHTTP        = "http_error"
+	CodeServer      = "server_error"
+	CodeRateLimited = "rate_limited"
+	CodeWait        = "wait_required"
+	CodeTimeout     = "timeout"
+	CodeNetwork     = "network"
+	CodeFilesystem  = "filesystem"
+	CodeUnknown     = "unknown"
+)
+
+// Error is a classified download failure. Permanent errors fail the download immediately;
+// the others are rescheduled with backoff until the attempt limit is reached.
+type Error struct {
+	Code      string
+	Permanent bool
+	// RetryAfter is a wait requested by the host, used instead of the backoff when longer.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+func permanentError(code string, err error) *Error {
+	return &Error{Code: code, Permanent: true, Err: err}
+}
+
+func transientError(code string, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// WaitError is a transient error asking to try again after d, such as a host's "wait N minutes" reply.
+func WaitError(d time.Duration, err error) *Error {
+	return &Error{Code: CodeWait, RetryAfter: d, Err: err}
+}
+
+// httpError classifies an unexpected HTTP response status.
+func httpError(resp *http.Response) *Error {
+	err := fmt.Errorf("server returned error: %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return permanentError(CodeNotFound, err)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return permanentError(CodeForbidden, err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &Error{Code: CodeRateLimited, RetryAfter: retryAfter(resp), Err: err}
+	case resp.StatusCode >= 500:
+		return &Error{Code: CodeServer, RetryAfter: retryAfter(resp), Err: err}
+	default:
+		return permanentError(CodeHTTP, err)
+	}
+}
+
+// retryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// classify turns any transfer error into an *Error. Errors that were not classified where they
+// happened are treated as transient network trouble when they look like it, unknown otherwise.
+func classify(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return transientError(CodeTimeout, err)
+	}
+	var interrupted *interruptedError
+	if errors.As(err, &interrupted) || errors.As(err, &netErr) {
+		return transientError(CodeNetwork, err)
+	}
+	return transientError(CodeUnknown, err)
+}
+
+// Settings keys for the retry policy.
+const (
+	SettingMaxAttempts    = "maxAttempts"
+	SettingRetryBaseDelay = "retryBaseDelay" // seconds
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultRetryBaseDelay = 30 * time.Second
+	maxRetryDelay         = time.Hour
+)
+
+// RetryPolicy decides whether and when a failed download is attempted again.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+// Delay returns the wait before the next attempt, given how many attempts have been made:
+// exponential in attempts, capped, with "equal jitter" so retries from many downloads spread out.
+func (p RetryPolicy) Delay(attempts int, e *Error) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	delay = delay/2 + rand.N(delay/2+1)
+	return max(delay, e.RetryAfter)
+}
@@ -0,0 +1,107 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// limiterChunk caps how many bytes a throttled read asks for at once, so waits stay short and smooth.
+const limiterChunk = 32 * 1024
+
+// maxLimiterWait bounds a single sleep so a rate change is picked up quickly by waiting readers.
+const maxLimiterWait = 250 * time.Millisecond
+
+// Limiter is a token bucket measured in bytes per second. A rate of 0 means unlimited.
+// It is safe for concurrent use and its rate can be changed while readers are waiting.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// SetRate changes the rate for all current and future readers.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(max(bytesPerSecond, 0))
+	l.tokens = min(l.tokens, l.burst())
+	l.last = time.Now()
+}
+
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// burst allows up to one second of traffic, and never less than one read chunk.
+func (l *Limiter) burst() float64 {
+	return max(l.rate, limiterChunk)
+}
+
+// WaitN blocks until n bytes may be consumed. n must not exceed limiterChunk.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst())
+		l.last = now
+		if l.tokens >= float64(n) {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((float64(n) - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(min(wait, maxLimiterWait))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// throttledReader draws every read from one or more limiters.
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+func throttle(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > limiterChunk {
+		p = p[:limiterChunk]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		for _, l := range t.limiters {
+			if l == nil {
+				continue
+			}
+			if werr := l.WaitN(t.ctx, n); werr != nil {
+				return n, werr
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,417 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"github.com/gautch29/downloader-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// pollInterval is how often the queue is checked when nobody calls Wake.
+const pollInterval = 5 * time.Second
+
+// progressInterval is how often a running transfer writes its progress back to the database.
+const progressInterval = time.Second
+
+// SettingConcurrency is the settings key holding the number of downloads allowed to run at once.
+const SettingConcurrency = "maxConcurrentDownloads"
+
+const (
+	DefaultConcurrency = 2
+	MaxConcurrency     = 20
+)
+
+// Manager claims waiting rows from the downloads table in queue order and runs up to
+// a configurable number of transfers at the same time.
+type Manager struct {
+	client *http.Client
+	wake   chan struct{}
+
+	// limiter is shared by every running transfer; its rate follows bandwidth.
+	limiter *Limiter
+
+	mu        sync.Mutex
+	limit     int
+	active    int
+	bandwidth BandwidthSchedule
+	hours     ActiveHours
+	running   map[int]*job
+	// reserved maps the paths given to running transfers to their download.
+	reserved map[string]int
+	// hold is why queued downloads are not being started, "" when they are.
+	hold string
+
+	account accountCache
+}
+
+// Default is the manager started by Start and signalled by Wake.
+var Default *Manager
+
+func NewManager(concurrency int, bandwidth BandwidthSchedule, hours ActiveHours) *Manager {
+	return &Manager{
+		// No overall timeout: transfers of large files legitimately take hours.
+		client:    &http.Client{CheckRedirect: integration.CheckRedirect},
+		wake:      make(chan struct{}, 1),
+		limiter:   NewLimiter(bandwidth.LimitAt(time.Now())),
+		limit:     clampConcurrency(concurrency),
+		bandwidth: bandwidth,
+		hours:     hours,
+		running:   make(map[int]*job),
+		reserved:  make(map[string]int),
+	}
+}
+
+// Start creates the Default manager, configured from the stored settings, and runs it in the
+// background until ctx is cancelled.
+func Start(ctx context.Context) {
+	concurrency := DefaultConcurrency
+	var bandwidth BandwidthSchedule
+
+	settings, err := database.GetSettings(ctx, SettingConcurrency, SettingBandwidthLimit, SettingBandwidthSchedule,
+		SettingActiveHoursStart, SettingActiveHoursEnd)
+	if err != nil {
+		log.Printf("downloader: failed to load settings, using defaults: %v", err)
+	}
+	if n, err := strconv.Atoi(settings[SettingConcurrency]); err == nil {
+		concurrency = n
+	}
+	if n, err := strconv.ParseInt(settings[SettingBandwidthLimit], 10, 64); err == nil {
+		bandwidth.Limit = n
+	}
+	if bandwidth.Rules, err = ParseBandwidthRules(settings[SettingBandwidthSchedule]); err != nil {
+		log.Printf("downloader: ignoring invalid bandwidth schedule: %v", err)
+	}
+
+	hours := ActiveHours{Start: settings[SettingActiveHoursStart], End: settings[SettingActiveHoursEnd]}
+	if err := hours.Validate(); err != nil {
+		log.Printf("downloader: ignoring invalid active hours: %v", err)
+		hours = ActiveHours{}
+	}
+
+	Default = NewManager(concurrency, bandwidth, hours)
+	go Default.Run(ctx)
+}
+
+// SetBandwidth replaces the Default manager's bandwidth schedule.
+func SetBandwidth(schedule BandwidthSchedule) {
+	if Default != nil {
+		Default.SetBandwidth(schedule)
+	}
+}
+
+// SetBandwidth replaces the bandwidth schedule and applies it to running transfers immediately.
+func (m *Manager) SetBandwidth(schedule BandwidthSchedule) {
+	m.mu.Lock()
+	m.bandwidth = schedule
+	m.mu.Unlock()
+	m.applyBandwidth(time.Now())
+}
+
+// SetActiveHours replaces the Default manager's active hours window.
+func SetActiveHours(hours ActiveHours) {
+	if Default != nil {
+		Default.SetActiveHours(hours)
+	}
+}
+
+// SetActiveHours changes the window during which queued downloads may start. Transfers already
+// running when the window closes are allowed to finish.
+func (m *Manager) SetActiveHours(hours ActiveHours) {
+	m.mu.Lock()
+	m.hours = hours
+	m.mu.Unlock()
+	m.Wake()
+}
+
+// ScheduledFor returns when a waiting download is expected to become eligible, given its own
+// start time and the Default manager's active hours, or nil when nothing holds it back.
+func ScheduledFor(startAt *time.Time, now time.Time) *time.Time {
+	var hours ActiveHours
+	if Default != nil {
+		Default.mu.Lock()
+		hours = Default.hours
+		Default.mu.Unlock()
+	}
+
+	t := now
+	if startAt != nil && startAt.After(now) {
+		t = startAt.In(now.Location())
+	}
+	t = hours.NextOpening(t)
+	if !t.After(now) {
+		return nil
+	}
+	return &t
+}
+
+// applyBandwidth sets the shared limiter to the rate the schedule calls for at t.
+func (m *Manager) applyBandwidth(t time.Time) {
+	m.mu.Lock()
+	limit := m.bandwidth.LimitAt(t)
+	m.mu.Unlock()
+	if m.limiter.Rate() != limit {
+		log.Printf("downloader: global bandwidth limit set to %d B/s", limit)
+		m.limiter.SetRate(limit)
+	}
+}
+
+// SetConcurrency resizes the Default manager's worker pool.
+func SetConcurrency(n int) {
+	if Default != nil {
+		Default.SetConcurrency(n)
+	}
+}
+
+// SetConcurrency changes how many transfers may run at once. Growing the pool starts queued
+// downloads immediately; shrinking it lets running transfers finish and holds new ones until
+// the number of active transfers drops below the new limit.
+func (m *Manager) SetConcurrency(n int) {
+	m.mu.Lock()
+	m.limit = clampConcurrency(n)
+	m.mu.Unlock()
+	m.Wake()
+}
+
+func clampConcurrency(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > MaxConcurrency {
+		return MaxConcurrency
+	}
+	return n
+}
+
+// Wake tells the Default manager to look at the queue now instead of waiting for the next poll.
+func Wake() {
+	if Default != nil {
+		Default.Wake()
+	}
+}
+
+func (m *Manager) Wake() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes the queue until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	// Rows left in "downloading" belong to a previous process that died mid-transfer.
+	if _, err := database.Pool.Exec(ctx,
+		"UPDATE downloads SET status=$1, speed=NULL, eta=NULL, updated_at=NOW() WHERE status=$2",
+		model.StatusPending, model.StatusDownloading); err != nil {
+		log.Printf("downloader: failed to requeue interrupted downloads: %v", err)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.applyBandwidth(time.Now())
+		m.fill(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// fill starts queued downloads until every slot in the pool is busy or the queue is empty.
+// Outside the active hours window, or while the 1fichier traffic left cannot cover the next
+// file, nothing new is started.
+func (m *Manager) fill(ctx context.Context) {
+	for {
+		m.mu.Lock()
+		if m.active >= m.limit || !m.hours.Contains(time.Now()) {
+			m.mu.Unlock()
+			return
+		}
+		m.active++
+		m.mu.Unlock()
+
+		reason := m.trafficHold(ctx)
+		m.setHold(reason)
+		if reason != "" {
+			m.release()
+			return
+		}
+
+		dl, err := m.claim(ctx)
+		if err != nil {
+			m.release()
+			if !errors.Is(err, pgx.ErrNoRows) && ctx.Err() == nil {
+				log.Printf("downloader: failed to claim download: %v", err)
+			}
+			return
+		}
+
+		// The job is registered before the worker starts, so a pause or cancel that follows the
+		// claim always finds it.
+		jobCtx, cancel := context.WithCancelCause(ctx)
+		j := &job{cancel: cancel, done: make(chan struct{})}
+		m.mu.Lock()
+		m.running[dl.ID] = j
+		m.mu.Unlock()
+
+		go func() {
+			defer m.Wake()
+			defer m.release()
+			m.process(ctx, jobCtx, dl, j)
+		}()
+	}
+}
+
+func (m *Manager) release() {
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+}
+
+// claim atomically moves the first waiting row that is due to "downloading" and returns it. The
+// attempt is counted by fail, so a resume or a restart does not use up the download's retries.
+func (m *Manager) claim(ctx context.Context) (*model.Download, error) {
+	var dl model.Download
+	err := database.Pool.QueryRow(ctx, `
+		UPDATE downloads SET status=$1, next_attempt_at=NULL, updated_at=NOW()
+		WHERE id = (
+			SELECT id FROM downloads
+			WHERE status = ANY($2)
+				AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+				AND (start_at IS NULL OR start_at <= NOW())
+			ORDER BY `+QueueOrder+`
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, url, filename, custom_filename, target_path, destination, remote_folder_id, password,
+			headers, cookies, auth_username, auth_password, segments, speed_limit, checksum, show, season, episode, downloaded,
+			attempts, status, created_at`,
+		model.StatusDownloading, WaitingStatuses,
+	).Scan(&dl.ID, &dl.URL, &dl.Filename, &dl.CustomFilename, &dl.TargetPath, &dl.Destination, &dl.RemoteFolderID, &dl.Password,
+		&dl.Headers, &dl.Cookies, &dl.AuthUsername, &dl.AuthPassword, &dl.Segments, &dl.SpeedLimit, &dl.Checksum, &dl.Show, &dl.Season, &dl.Episode, &dl.Downloaded, &dl.Attempts,
+		&dl.Status, &dl.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// process runs the transfer of a claimed download as job j, whose context is jobCtx, and records
+// the outcome.
+func (m *Manager) process(ctx, jobCtx context.Context, dl *model.Download, j *job) {
+	log.Printf("downloader: starting download %d (%s)", dl.ID, integration.Redact(dl.URL))
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, dl.ID)
+		m.mu.Unlock()
+		j.cancel(nil)
+		close(j.done)
+	}()
+
+	var result *transferResult
+	var err error
+	if dl.Destination == model.DestinationOneFichier {
+		result, err = m.remoteUpload(jobCtx, dl)
+	} else {
+		result, err = m.transfer(jobCtx, dl)
+	}
+	if err != nil {
+		// Shutting down is not the download's fault; leave it and its .part file for the next start.
+		if ctx.Err() != nil {
+			return
+		}
+		// Paused, cancelled or deleted: the row has already been updated by the caller of Stop.
+		if errors.Is(context.Cause(jobCtx), errStopped) {
+			log.Printf("downloader: download %d stopped", dl.ID)
+			return
+		}
+		m.fail(ctx, dl, classify(err))
+		return
+	}
+
+	// Only a row still owned by this worker is completed; a pause that raced the last bytes wins.
+	_, err = database.Pool.Exec(context.Background(),
+		`UPDATE downloads SET status=$1, progress=100, downloaded=COALESCE(size, downloaded), speed=NULL, eta=0,
+			file_hash=NULLIF($2, ''), remote_id=$3, error=NULL, error_code=NULL, next_attempt_at=NULL, updated_at=NOW()
+		WHERE id=$4 AND status=$5`,
+		model.StatusCompleted, result.Hash, result.RemoteID, dl.ID, model.StatusDownloading)
+	if err != nil {
+		log.Printf("downloader: failed to mark download %d as completed: %v", dl.ID, err)
+		return
+	}
+	log.Printf("downloader: download %d completed: %s (%s)", dl.ID, result.Path, result.Hash)
+}
+
+// fail records a failed attempt. Transient errors put the download back in the queue after a
+// backoff delay; permanent errors, and transient ones once attempts run out, mark it as failed.
+func (m *Manager) fail(ctx context.Context, dl *model.Download, cause *Error) {
+	policy := retryPolicy(ctx)
+	attempt := dl.Attempts + 1
+	if cause.Permanent || attempt >= policy.MaxAttempts {
+		log.Printf("downloader: download %d failed (%s, attempt %d): %v", dl.ID, cause.Code, attempt, cause)
+		if err := recordFailure(dl.ID, model.StatusError, cause, nil); err != nil {
+			log.Printf("downloader: failed to mark download %d as failed: %v", dl.ID, err)
+		}
+		return
+	}
+
+	next := time.Now().Add(policy.Delay(attempt, cause))
+	log.Printf("downloader: download %d failed (%s, attempt %d/%d), retrying at %s: %v",
+		dl.ID, cause.Code, attempt, policy.MaxAttempts, next.Format(time.RFC3339), cause)
+	if err := recordFailure(dl.ID, model.StatusQueued, cause, &next); err != nil {
+		log.Printf("downloader: failed to reschedule download %d: %v", dl.ID, err)
+	}
+}
+
+// recordFailure counts a failed attempt of a download still owned by its worker, moving it to
+// status with the error and the time of the next attempt, if any. retryPolicy reads the retry
+// settings. Both are variables so tests can run without a database.
+var (
+	recordFailure = func(id int, status model.DownloadStatus, cause *Error, next *time.Time) error {
+		_, err := database.Pool.Exec(context.Background(), `
+			UPDATE downloads SET status=$1, attempts=attempts+1, speed=NULL, eta=NULL, error=$2, error_code=$3,
+				next_attempt_at=$4, updated_at=NOW()
+			WHERE id=$5 AND status=$6`,
+			status, cause.Error(), cause.Code, next, id, model.StatusDownloading)
+		return err
+	}
+	retryPolicy = loadRetryPolicy
+)
+
+// loadRetryPolicy reads the retry settings, falling back to defaults for missing or invalid values.
+func loadRetryPolicy(ctx context.Context) RetryPolicy {
+	policy := RetryPolicy{MaxAttempts: DefaultMaxAttempts, BaseDelay: DefaultRetryBaseDelay}
+	settings, err := database.GetSettings(ctx, SettingMaxAttempts, SettingRetryBaseDelay)
+	if err != nil {
+		return policy
+	}
+	if n, err := strconv.Atoi(settings[SettingMaxAttempts]); err == nil && n > 0 {
+		policy.MaxAttempts = n
+	}
+	if n, err := strconv.Atoi(settings[SettingRetryBaseDelay]); err == nil && n >= 0 {
+		policy.BaseDelay = time.Duration(n) * time.Second
+	}
+	return policy
+}
+
+// DownloadDir returns the directory used when a download has no target path.
+func DownloadDir() string {
+	if dir := os.Getenv("DOWNLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return "downloads"
+}
@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+func TestResumeDoesNotUseAnAttempt(t *testing.T) {
+	m := testManager(t)
+	type failure struct {
+		status model.DownloadStatus
+		code   string
+	}
+	var failures []failure
+	savedFailure, savedPolicy := recordFailure, retryPolicy
+	recordFailure = func(id int, status model.DownloadStatus, cause *Error, next *time.Time) error {
+		failures = append(failures, failure{status, cause.Code})
+		return nil
+	}
+	retryPolicy = func(context.Context) RetryPolicy { return RetryPolicy{MaxAttempts: 2} }
+	t.Cleanup(func() { recordFailure, retryPolicy = savedFailure, savedPolicy })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	dl := newDownload(t, srv.URL+"/file.bin")
+
+	// Paused and resumed, then interrupted by a restart: neither run failed.
+	for range 3 {
+		jobCtx, cancel := context.WithCancelCause(context.Background())
+		cancel(errStopped)
+		m.process(context.Background(), jobCtx, dl, &job{cancel: cancel, done: make(chan struct{})})
+	}
+	if len(failures) != 0 {
+		t.Fatalf("stopped runs recorded failures: %v", failures)
+	}
+
+	// The first real failure is the first of the two attempts, so the download is retried.
+	jobCtx, cancel := context.WithCancelCause(context.Background())
+	m.process(context.Background(), jobCtx, dl, &job{cancel: cancel, done: make(chan struct{})})
+	if len(failures) != 1 || failures[0].status != model.StatusQueued || failures[0].code != CodeServer {
+		t.Fatalf("failures = %v, want one retry after %s", failures, CodeServer)
+	}
+
+	// The second one uses up the attempts.
+	dl.Attempts++
+	jobCtx, cancel = context.WithCancelCause(context.Background())
+	m.process(context.Background(), jobCtx, dl, &job{cancel: cancel, done: make(chan struct{})})
+	if len(failures) != 2 || failures[1].status != model.StatusError {
+		t.Fatalf("failures = %v, want the download failed", failures)
+	}
+}
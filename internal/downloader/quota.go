@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration/onefichier"
+	"github.com/gautch29/downloader-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// accountRefreshInterval is how long the 1fichier account information, or the failure to read
+// it, is trusted before it is fetched again.
+const accountRefreshInterval = time.Minute
+
+// accountCache keeps the last 1fichier account information so the queue can be checked
+// against the remaining traffic without calling the API on every pass. A failure is kept as
+// long, so a wrong key or an outage does not cost a rate-limited call on every pass.
+type accountCache struct {
+	mu      sync.Mutex
+	info    *onefichier.AccountInfo
+	err     error
+	fetched time.Time
+}
+
+// get returns the account information, fetching it when the cached result is stale. Failures
+// are logged when they happen, not each time they are returned from the cache.
+func (c *accountCache) get(ctx context.Context) (*onefichier.AccountInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fetched.IsZero() && time.Since(c.fetched) < accountRefreshInterval {
+		return c.info, c.err
+	}
+
+	apiKey := os.Getenv("ONEFICHIER_API_KEY")
+	if apiKey == "" {
+		c.info, c.err = nil, fmt.Errorf("1fichier API key is not configured")
+	} else {
+		c.info, c.err = onefichier.NewClient(apiKey).AccountInfo(ctx)
+	}
+	if c.err != nil && ctx.Err() != nil {
+		// Cancelled while fetching: not worth remembering.
+		return nil, c.err
+	}
+	c.fetched = time.Now()
+	if c.err != nil {
+		log.Printf("downloader: failed to read 1fichier account: %v", c.err)
+	}
+	return c.info, c.err
+}
+
+// HoldReason returns why the Default manager is not starting queued downloads, or "" when it is not held.
+func HoldReason() string {
+	if Default == nil {
+		return ""
+	}
+	m := Default
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hold
+}
+
+// setHold records why the queue is held, logging changes.
+func (m *Manager) setHold(reason string) {
+	m.mu.Lock()
+	changed := m.hold != reason
+	m.hold = reason
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+	if reason == "" {
+		log.Printf("downloader: queue resumed")
+	} else {
+		log.Printf("downloader: queue held: %s", reason)
+	}
+}
+
+// trafficHold checks the download due next against the 1fichier account's remaining traffic
+// and returns a reason to hold the queue when it cannot cover the rest of the file. Failures
+// to read the account or the queue never hold it.
+func (m *Manager) trafficHold(ctx context.Context) string {
+	var url, filename, destination string
+	var size *int64
+	var downloaded int64
+	err := database.Pool.QueryRow(ctx, `
+		SELECT url, COALESCE(custom_filename, filename, url), size, downloaded, destination FROM downloads
+		WHERE status = ANY($1)
+			AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+			AND (start_at IS NULL OR start_at <= NOW())
+		ORDER BY `+QueueOrder+`
+		LIMIT 1`, WaitingStatuses,
+	).Scan(&url, &filename, &size, &downloaded, &destination)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) && ctx.Err() == nil {
+			log.Printf("downloader: failed to read the next download: %v", err)
+		}
+		return ""
+	}
+	// Remote uploads are fetched by 1fichier itself and use no download traffic.
+	if size == nil || !onefichier.IsLink(url) || destination != model.DestinationLocal {
+		return ""
+	}
+
+	account, err := m.account.get(ctx)
+	if err != nil {
+		return ""
+	}
+
+	kind, left := "cold", account.ColdTraffic
+	if settings, err := database.GetSettings(ctx, onefichier.SettingCDN); err == nil && settings[onefichier.SettingCDN] == "true" {
+		kind, left = "hot", account.HotTraffic
+	}
+	needed := *size - downloaded
+	if left == nil || *left >= needed {
+		return ""
+	}
+	return fmt.Sprintf("1fichier %s traffic left (%s) cannot cover %q (%s remaining)",
+		kind, formatBytes(*left), filename, formatBytes(needed))
+}
+
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.2f GB", float64(n)/1024/1024/1024)
+}
@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+// oneTimeHoster hands out a new direct link on every Resolve, like 1fichier's one-time links.
+type oneTimeHoster struct {
+	mu       sync.Mutex
+	base     string
+	resolved int
+}
+
+var oneTime = &oneTimeHoster{}
+
+func init() {
+	integration.Register(oneTime)
+}
+
+func (h *oneTimeHoster) Name() string { return "one-time" }
+
+func (h *oneTimeHoster) Match(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "https://one-time.example/")
+}
+
+func (h *oneTimeHoster) Resolve(ctx context.Context, rawURL string, opts integration.Options) (*integration.DirectLink, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resolved++
+	return &integration.DirectLink{URL: fmt.Sprintf("%s/dl/%d/file.bin", h.base, h.resolved)}, nil
+}
+
+func (h *oneTimeHoster) Info(ctx context.Context, rawURL string, opts integration.Options) (*integration.FileInfo, error) {
+	return nil, integration.ErrNotFound
+}
+
+func (h *oneTimeHoster) Check(ctx context.Context) (string, error) { return "Ready", nil }
+
+func TestReconnectAsksForANewLink(t *testing.T) {
+	tests := []struct {
+		name string
+		// first answers the first request for the first link; later requests for it get 403.
+		first func(w http.ResponseWriter, data []byte)
+	}{
+		{"dropped", func(w http.ResponseWriter, data []byte) {
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			w.Write(data[:len(data)/3])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}},
+		{"expired", func(w http.ResponseWriter, data []byte) {
+			http.Error(w, "link expired", http.StatusForbidden)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testManager(t)
+			data := testData(128 << 10)
+			var firstUses atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.URL.Path, "/dl/1/") {
+					if firstUses.Add(1) == 1 {
+						tt.first(w, data)
+					} else {
+						http.Error(w, "link expired", http.StatusForbidden)
+					}
+					return
+				}
+				serveRange(w, r, data)
+			}))
+			defer srv.Close()
+			oneTime.mu.Lock()
+			oneTime.base, oneTime.resolved = srv.URL, 0
+			oneTime.mu.Unlock()
+
+			dl := newDownload(t, "https://one-time.example/abc")
+			result, err := m.transfer(context.Background(), dl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFile(t, result.Path, data)
+			if oneTime.resolved != 2 {
+				t.Errorf("%d links asked for, want 2", oneTime.resolved)
+			}
+			if n := firstUses.Load(); n != 1 {
+				t.Errorf("the first link was used %d times", n)
+			}
+		})
+	}
+}
+
+// serveRange serves data, answering a "bytes=N-" Range request with the rest of it.
+func serveRange(w http.ResponseWriter, r *http.Request, data []byte) {
+	var start int
+	w.Header().Set("Accept-Ranges", "bytes")
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)-start))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	}
+	w.Write(data[start:])
+}
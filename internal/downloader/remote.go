@@ -0,0 +1,49 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/gautch29/downloader-backend/internal/integration/onefichier"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// remoteUpload mirrors a download into the 1fichier account instead of transferring it here:
+// 1fichier is asked to fetch the URL itself, once unwrapped from any link protector, and the
+// download is complete once the request is accepted.
+func (m *Manager) remoteUpload(ctx context.Context, dl *model.Download) (*transferResult, error) {
+	apiKey := os.Getenv("ONEFICHIER_API_KEY")
+	if apiKey == "" {
+		return nil, permanentError(CodeForbidden, fmt.Errorf("1fichier API key is not configured: %w", onefichier.ErrInvalidKey))
+	}
+	if err := unwrap(ctx, dl); err != nil {
+		return nil, err
+	}
+
+	folderID := 0
+	if dl.RemoteFolderID != nil {
+		folderID = *dl.RemoteFolderID
+	}
+	// 1fichier fetches the link itself, so it gets the login stored apart from it.
+	link := dl.URL
+	if u, err := url.Parse(link); err == nil && dl.AuthUsername != nil {
+		u.User = url.UserPassword(*dl.AuthUsername, deref(dl.AuthPassword))
+		link = u.String()
+	}
+	id, err := requestRemoteUpload(ctx, apiKey, link, folderID)
+	if err != nil {
+		return nil, classifyHoster(fmt.Errorf("1fichier remote upload: %w", err))
+	}
+
+	log.Printf("downloader: download %d handed to 1fichier as remote upload %d", dl.ID, id)
+	return &transferResult{Path: fmt.Sprintf("1fichier folder %d", folderID), RemoteID: &id}, nil
+}
+
+// requestRemoteUpload asks 1fichier to fetch a link into a folder. It is a variable so tests can
+// run without the API.
+var requestRemoteUpload = func(ctx context.Context, apiKey, link string, folderID int) (int, error) {
+	return onefichier.NewClient(apiKey).RemoteUpload(ctx, []string{link}, folderID)
+}
@@ -0,0 +1,51 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	_ "github.com/gautch29/downloader-backend/internal/integration/onefichier"
+	"github.com/gautch29/downloader-backend/internal/integration/protector"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+func TestRemoteUploadUnwrapsProtectedLinks(t *testing.T) {
+	m := testManager(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<div class="lienet"><a href="https://1fichier.com/?remote42">1fichier</a></div>`))
+	}))
+	defer srv.Close()
+	protector.Register(protector.Pattern{
+		Name: "test",
+		URL:  regexp.MustCompile("^" + regexp.QuoteMeta(srv.URL) + "/"),
+		Link: regexp.MustCompile(`(?is)class=["']lienet["'][^>]*>\s*<a[^>]*href=["']([^"']+)["']`),
+	})
+
+	t.Setenv("ONEFICHIER_API_KEY", "key")
+	var requested, recorded string
+	savedUpload, savedURL := requestRemoteUpload, recordURL
+	requestRemoteUpload = func(ctx context.Context, apiKey, link string, folderID int) (int, error) {
+		requested = link
+		return 7, nil
+	}
+	recordURL = func(ctx context.Context, id int, link string) error {
+		recorded = link
+		return nil
+	}
+	t.Cleanup(func() { requestRemoteUpload, recordURL = savedUpload, savedURL })
+
+	dl := &model.Download{ID: 1, URL: srv.URL + "/abc", Destination: model.DestinationOneFichier}
+	result, err := m.remoteUpload(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != "https://1fichier.com/?remote42" || recorded != requested {
+		t.Errorf("uploaded %q and recorded %q, want the unwrapped link", requested, recorded)
+	}
+	if result.RemoteID == nil || *result.RemoteID != 7 {
+		t.Errorf("remote id = %v", result.RemoteID)
+	}
+}
@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"github.com/gautch29/downloader-backend/internal/integration/protector"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// Error codes of hoster failures.
+const (
+	// CodeHoster is a hoster API failure that is not otherwise classified.
+	CodeHoster = "hoster_error"
+	// CodePasswordRequired is a password-protected file whose password is missing or wrong.
+	CodePasswordRequired = "password_required"
+	// CodeCaptchaRequired is a protected link whose protector asks for a captcha.
+	CodeCaptchaRequired = "captcha_required"
+)
+
+// resolve works out what the transfer should fetch, as given by the hoster handling the
+// download's link, once unwrapped from any link protector: hoster page links are exchanged for
+// a direct link, plain links are kept and sent with the download's headers, cookies and
+// credentials, and links read over another protocol, such as FTP, are left to the hoster's
+// Opener.
+func (m *Manager) resolve(ctx context.Context, dl *model.Download, st *transferState) error {
+	if err := unwrap(ctx, dl); err != nil {
+		return err
+	}
+
+	h := integration.Lookup(dl.URL)
+	if h == nil {
+		return permanentError(CodeInvalidURL, fmt.Errorf("no hoster supports %s", dl.URL))
+	}
+
+	opts := integration.Options{Header: integration.RequestHeader(dl.Headers, dl.Cookies, deref(dl.AuthUsername), deref(dl.AuthPassword))}
+	if dl.Password != nil {
+		opts.Password = *dl.Password
+	}
+	if dl.AuthUsername != nil {
+		opts.Login = url.UserPassword(*dl.AuthUsername, deref(dl.AuthPassword))
+	}
+	st.opts = opts
+	if opener, ok := h.(integration.Opener); ok {
+		st.url, st.opener = dl.URL, opener
+		return nil
+	}
+	link, err := h.Resolve(ctx, dl.URL, opts)
+	if err != nil {
+		return classifyHoster(fmt.Errorf("%s: %w", h.Name(), err))
+	}
+	st.url, st.header = link.URL, link.Header
+	if link.URL != dl.URL {
+		// A link handed out by the hoster is asked for again when reconnecting (see relink).
+		st.hoster = h
+	}
+	return nil
+}
+
+// unwrap replaces a download's link with the hoster link it leads to when it is wrapped in a
+// link protector, recording it so later runs go straight to the hoster.
+func unwrap(ctx context.Context, dl *model.Download) error {
+	if !protector.Match(dl.URL) {
+		return nil
+	}
+	link, err := protector.Unwrap(ctx, dl.URL)
+	if err != nil {
+		return classifyHoster(err)
+	}
+	if err := recordURL(ctx, dl.ID, link); err != nil {
+		log.Printf("downloader: failed to record unwrapped link for download %d: %v", dl.ID, err)
+	}
+	dl.URL = link
+	return nil
+}
+
+// recordURL stores the link a download was unwrapped to. It is a variable so tests can run
+// without a database.
+var recordURL = func(ctx context.Context, id int, link string) error {
+	_, err := database.Pool.Exec(ctx, "UPDATE downloads SET url=$1, updated_at=NOW() WHERE id=$2", link, id)
+	return err
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// classifyHoster maps a hoster failure to a download error.
+func classifyHoster(err error) error {
+	switch {
+	case errors.Is(err, integration.ErrUnauthorized):
+		return permanentError(CodeForbidden, err)
+	case errors.Is(err, integration.ErrPasswordRequired):
+		return permanentError(CodePasswordRequired, err)
+	case errors.Is(err, integration.ErrNotFound), errors.Is(err, protector.ErrNoLink):
+		return permanentError(CodeNotFound, err)
+	case errors.Is(err, protector.ErrCaptchaRequired):
+		return permanentError(CodeCaptchaRequired, err)
+	case errors.Is(err, integration.ErrWaitRequired):
+		return WaitError(integration.RetryAfter(err), err)
+	case errors.Is(err, integration.ErrRateLimited):
+		return &Error{Code: CodeRateLimited, RetryAfter: integration.RetryAfter(err), Err: err}
+	}
+	if e := classify(err); e.Code != CodeUnknown {
+		return e
+	}
+	return transientError(CodeHoster, err)
+}
@@ -0,0 +1,141 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Settings keys for bandwidth limiting. Limits are in bytes per second, 0 meaning unlimited.
+const (
+	SettingBandwidthLimit    = "bandwidthLimit"
+	SettingBandwidthSchedule = "bandwidthSchedule"
+)
+
+// BandwidthRule limits the global rate during a daily time window, e.g. 18:00-23:00.
+// A window whose end is before its start wraps past midnight.
+type BandwidthRule struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Limit int64  `json:"limit"`
+}
+
+func (r BandwidthRule) Validate() error {
+	if _, err := parseClock(r.Start); err != nil {
+		return fmt.Errorf("invalid start %q: %w", r.Start, err)
+	}
+	if _, err := parseClock(r.End); err != nil {
+		return fmt.Errorf("invalid end %q: %w", r.End, err)
+	}
+	if r.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+// BandwidthSchedule is the global limit plus the time windows that override it.
+type BandwidthSchedule struct {
+	Limit int64
+	Rules []BandwidthRule
+}
+
+// LimitAt returns the limit in force at t: the first matching rule, or the default limit.
+func (s BandwidthSchedule) LimitAt(t time.Time) int64 {
+	for _, rule := range s.Rules {
+		if inWindow(rule.Start, rule.End, t) {
+			return rule.Limit
+		}
+	}
+	return s.Limit
+}
+
+// ParseBandwidthRules decodes the JSON stored under SettingBandwidthSchedule.
+func ParseBandwidthRules(value string) ([]BandwidthRule, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var rules []BandwidthRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inWindow reports whether t's local time of day falls in [start, end). Malformed bounds never match.
+func inWindow(start, end string, t time.Time) bool {
+	from, err := parseClock(start)
+	if err != nil {
+		return false
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// Settings keys for the daily window outside which no new download is started.
+const (
+	SettingActiveHoursStart = "activeHoursStart"
+	SettingActiveHoursEnd   = "activeHoursEnd"
+)
+
+// ActiveHours is a daily "HH:MM" window during which queued downloads may start.
+// An empty window means the queue is always processed.
+type ActiveHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func (h ActiveHours) Enabled() bool {
+	return h.Start != "" && h.End != "" && h.Start != h.End
+}
+
+func (h ActiveHours) Validate() error {
+	if h.Start == "" && h.End == "" {
+		return nil
+	}
+	if _, err := parseClock(h.Start); err != nil {
+		return fmt.Errorf("invalid start %q: %w", h.Start, err)
+	}
+	if _, err := parseClock(h.End); err != nil {
+		return fmt.Errorf("invalid end %q: %w", h.End, err)
+	}
+	return nil
+}
+
+// Contains reports whether downloads may start at t.
+func (h ActiveHours) Contains(t time.Time) bool {
+	return !h.Enabled() || inWindow(h.Start, h.End, t)
+}
+
+// NextOpening returns the earliest time at or after t when downloads may start.
+func (h ActiveHours) NextOpening(t time.Time) time.Time {
+	if h.Contains(t) {
+		return t
+	}
+	from, _ := parseClock(h.Start)
+	opening := time.Date(t.Year(), t.Month(), t.Day(), from/60, from%60, 0, 0, t.Location())
+	if !opening.After(t) {
+		opening = opening.AddDate(0, 0, 1)
+	}
+	return opening
+}
@@ -0,0 +1,302 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// SettingMaxSegments is the settings key holding the upper bound for per-download segment counts.
+const SettingMaxSegments = "maxSegments"
+
+const (
+	DefaultMaxSegments = 4
+	MaxSegments        = 16
+)
+
+// segmentsSuffix names the sidecar file that records per-segment progress of a segmented .part file.
+const segmentsSuffix = ".part.segments"
+
+// minSegmentSize keeps small files from being split into pointlessly tiny ranges.
+const minSegmentSize = 1 << 20
+
+var errRangesUnsupported = errors.New("server does not support byte ranges")
+
+// segment is one byte range of a segmented transfer. End is inclusive.
+type segment struct {
+	Start int64
+	End   int64
+	done  atomic.Int64
+}
+
+// segmentState is the on-disk form of a segment, saved next to the .part file so a later run can resume.
+type segmentState struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+// segmentCount returns how many connections a download may use, bounded by the global setting.
+func segmentCount(ctx context.Context, dl *model.Download) int {
+	if dl.Segments <= 1 {
+		return 1
+	}
+	return max(1, min(dl.Segments, maxSegments(ctx), MaxSegments))
+}
+
+// maxSegments reads the global segment limit. It is a variable so tests can run without a database.
+var maxSegments = func(ctx context.Context) int {
+	settings, err := database.GetSettings(ctx, SettingMaxSegments)
+	if err == nil {
+		if n, err := strconv.Atoi(settings[SettingMaxSegments]); err == nil {
+			return n
+		}
+	}
+	return DefaultMaxSegments
+}
+
+// fetchSegmented downloads the resolved URL over n parallel range requests written into a shared .part file.
+// It returns errRangesUnsupported when the server cannot serve ranges, so the caller can fall back
+// to a single stream.
+func (m *Manager) fetchSegmented(ctx context.Context, dl *model.Download, st *transferState, n int) error {
+	total, err := m.probeRanges(ctx, dl, st)
+	if err != nil {
+		return err
+	}
+	if total < int64(n)*minSegmentSize {
+		n = max(1, int(total/minSegmentSize))
+	}
+
+	part := st.dest + partSuffix
+	sidecar := st.dest + segmentsSuffix
+	segs := loadSegments(sidecar, total)
+	if segs == nil {
+		segs = planSegments(total, n)
+		os.Remove(part)
+	}
+
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to open partial file: %w", err))
+	}
+	defer f.Close()
+	if err := f.Truncate(total); err != nil {
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to allocate partial file: %w", err))
+	}
+
+	var written int64
+	for _, s := range segs {
+		written += s.done.Load()
+	}
+	st.total.Store(total)
+	st.written.Store(written)
+	st.resumable = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Persist segment progress periodically so a crash loses at most one interval of work.
+	saverDone := make(chan struct{})
+	go func() {
+		defer close(saverDone)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				saveSegments(sidecar, segs)
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, s := range segs {
+		wg.Add(1)
+		go func(s *segment) {
+			defer wg.Done()
+			if err := m.fetchSegment(ctx, dl, f, s, st); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(s)
+	}
+	wg.Wait()
+	cancel()
+	<-saverDone
+
+	if firstErr != nil {
+		saveSegments(sidecar, segs)
+		return firstErr
+	}
+	if err := f.Sync(); err != nil {
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to write partial file: %w", err))
+	}
+	os.Remove(sidecar)
+	return nil
+}
+
+// probeRanges asks for the first byte of the file to learn its size and whether ranges are
+// supported, and resolves the destination path from the response.
+func (m *Manager) probeRanges(ctx context.Context, dl *model.Download, st *transferState) (int64, error) {
+	req, err := st.newRequest(ctx)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, connectError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, errRangesUnsupported
+	}
+	_, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || total <= 0 {
+		return 0, errRangesUnsupported
+	}
+
+	if st.dest == "" {
+		st.dest = m.destination(dl, resolveFilename(dl, resp))
+	}
+	if err := prepareDestination(ctx, dl.ID, st.dest, &total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// fetchSegment downloads the remaining bytes of one segment, reconnecting when the stream drops.
+func (m *Manager) fetchSegment(ctx context.Context, dl *model.Download, f *os.File, s *segment, st *transferState) error {
+	for attempt := 1; ; attempt++ {
+		offset := s.Start + s.done.Load()
+		if offset > s.End {
+			return nil
+		}
+
+		stale, _ := st.link()
+		err := m.fetchRange(ctx, f, offset, s, st)
+		if err == nil {
+			continue
+		}
+
+		var interrupted *interruptedError
+		if !errors.As(err, &interrupted) || attempt >= maxReconnects || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("downloader: download %d: segment %d-%d: %v, reconnecting (%d/%d)",
+			dl.ID, s.Start, s.End, err, attempt, maxReconnects-1)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * reconnectDelay):
+		}
+		if err := m.relink(ctx, dl, st, stale); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Manager) fetchRange(ctx context.Context, f *os.File, offset int64, s *segment, st *transferState) error {
+	req, err := st.newRequest(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, s.End))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return connectError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return st.httpError(resp)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return transientError(CodeServer, fmt.Errorf("server ignored range request: %s", resp.Status))
+	}
+	if start, _, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || start != offset {
+		return transientError(CodeServer, fmt.Errorf("server returned an unexpected range: %q", resp.Header.Get("Content-Range")))
+	}
+
+	w := io.MultiWriter(io.NewOffsetWriter(f, offset), &countingWriter{&s.done}, &countingWriter{&st.written})
+	if _, err := io.Copy(w, m.throttle(ctx, io.LimitReader(resp.Body, s.End-offset+1), st)); err != nil {
+		return &interruptedError{err}
+	}
+	if s.Start+s.done.Load() <= s.End {
+		return &interruptedError{fmt.Errorf("segment %d-%d ended early", s.Start, s.End)}
+	}
+	return nil
+}
+
+// planSegments splits total bytes into n contiguous ranges.
+func planSegments(total int64, n int) []*segment {
+	size := total / int64(n)
+	segs := make([]*segment, n)
+	for i := range segs {
+		start := int64(i) * size
+		end := start + size - 1
+		if i == n-1 {
+			end = total - 1
+		}
+		segs[i] = &segment{Start: start, End: end}
+	}
+	return segs
+}
+
+// loadSegments reads a sidecar written by an earlier run. It returns nil when there is none or
+// when it does not describe a file of the given size.
+func loadSegments(path string, total int64) []*segment {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var states []segmentState
+	if err := json.Unmarshal(data, &states); err != nil || len(states) == 0 {
+		return nil
+	}
+	if states[len(states)-1].End != total-1 {
+		return nil
+	}
+
+	segs := make([]*segment, len(states))
+	for i, state := range states {
+		segs[i] = &segment{Start: state.Start, End: state.End}
+		segs[i].done.Store(state.Done)
+	}
+	return segs
+}
+
+func saveSegments(path string, segs []*segment) {
+	states := make([]segmentState, len(segs))
+	for i, s := range segs {
+		states[i] = segmentState{Start: s.Start, End: s.End, Done: s.done.Load()}
+	}
+	data, _ := json.Marshal(states)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		log.Printf("downloader: failed to save segment state %s: %v", path, err)
+	}
+}
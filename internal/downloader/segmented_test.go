@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// segmentedManager returns a test manager allowing up to n segments per download.
+func segmentedManager(t *testing.T, n int) *Manager {
+	t.Helper()
+	saved := maxSegments
+	maxSegments = func(context.Context) int { return n }
+	t.Cleanup(func() { maxSegments = saved })
+	return testManager(t)
+}
+
+// serveRanges serves data with range support and collects the Range headers it was sent.
+func serveRanges(t *testing.T, data []byte) (*httptest.Server, func() []string) {
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Sorted(slices.Values(ranges))
+	}
+}
+
+func TestSegmentedTransfer(t *testing.T) {
+	m := segmentedManager(t, 4)
+	data := testData(4 * minSegmentSize)
+	srv, ranges := serveRanges(t, data)
+	dl := newDownload(t, srv.URL+"/file.bin")
+	dl.Segments = 4
+
+	result, err := m.transfer(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, result.Path, data)
+	want := []string{"bytes=0-0", "bytes=0-1048575", "bytes=1048576-2097151", "bytes=2097152-3145727", "bytes=3145728-4194303"}
+	if got := ranges(); !slices.Equal(got, want) {
+		t.Errorf("Range headers = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(result.Path + segmentsSuffix); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", result.Path+segmentsSuffix)
+	}
+}
+
+func TestSegmentedTransferResumes(t *testing.T) {
+	m := segmentedManager(t, 4)
+	data := testData(4 * minSegmentSize)
+	srv, ranges := serveRanges(t, data)
+	dl := newDownload(t, srv.URL+"/file.bin")
+	dl.Segments = 4
+
+	// An earlier run got through the first half of every segment.
+	const half = minSegmentSize / 2
+	part := make([]byte, len(data))
+	var states []segmentState
+	for _, s := range planSegments(int64(len(data)), 4) {
+		copy(part[s.Start:s.Start+half], data[s.Start:])
+		states = append(states, segmentState{Start: s.Start, End: s.End, Done: half})
+	}
+	sidecar, _ := json.Marshal(states)
+	name := "file.bin"
+	dl.Filename, dl.Downloaded = &name, 4*half
+	dest := filepath.Join(*dl.TargetPath, name)
+	if err := os.WriteFile(dest+partSuffix, part, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+segmentsSuffix, sidecar, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := m.transfer(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, result.Path, data)
+	want := []string{"bytes=0-0", "bytes=1572864-2097151", "bytes=2621440-3145727", "bytes=3670016-4194303", "bytes=524288-1048575"}
+	if got := ranges(); !slices.Equal(got, want) {
+		t.Errorf("Range headers = %q, want %q", got, want)
+	}
+}
+
+func TestSegmentedTransferFallsBackWhenRangeIgnored(t *testing.T) {
+	m := segmentedManager(t, 4)
+	data := testData(4 * minSegmentSize)
+	srv, requests := serveFile(t, data, 0, false)
+	dl := newDownload(t, srv.URL+"/file.bin")
+	dl.Segments = 4
+
+	result, err := m.transfer(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, result.Path, data)
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want the probe and one stream", n)
+	}
+	if _, err := os.Stat(result.Path + segmentsSuffix); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", result.Path+segmentsSuffix)
+	}
+}
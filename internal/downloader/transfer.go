@@ -0,0 +1,643 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// partSuffix is appended to the destination path while a file is still being written.
+const partSuffix = ".part"
+
+// maxReconnects bounds how many times a single run re-opens a connection that dropped mid-stream.
+const maxReconnects = 5
+
+// reconnectDelay is the wait before the first reconnection; later ones wait longer.
+var reconnectDelay = 2 * time.Second
+
+// transferState is shared by the successive connections of one run.
+type transferState struct {
+	mu     sync.Mutex          // guards url and header, which relink replaces
+	url    string              // direct URL fetched by every connection of this run
+	header http.Header         // sent with every request for url
+	hoster integration.Hoster  // handed out url for the download's link, which may expire; nil when url is the link
+	opener integration.Opener  // reads url instead of HTTP, nil for HTTP links
+	opts   integration.Options // passed to opener and hoster
+
+	dest      string   // final path, known once a filename has been resolved
+	resumable bool     // the server advertised byte-range support
+	limiter   *Limiter // per-download cap, nil when unlimited
+	hasher    *fileHasher
+
+	written atomic.Int64 // bytes present in the .part file
+	total   atomic.Int64 // expected size, or -1 when unknown
+}
+
+// interruptedError reports a connection that failed after the body started streaming,
+// which is worth reconnecting for.
+type interruptedError struct {
+	err error
+}
+
+func (e *interruptedError) Error() string { return "transfer interrupted: " + e.err.Error() }
+func (e *interruptedError) Unwrap() error { return e.err }
+
+// transferResult describes a completed transfer.
+type transferResult struct {
+	Path     string
+	Hash     string // fileHashAlgo digest of the content, as "algo:hex"; empty for remote uploads
+	RemoteID *int   // 1fichier remote upload request, for remote uploads
+}
+
+// transfer fetches a download into its target directory, verifies it against the expected checksum
+// if there is one, and moves it into place.
+// Data is written to a .part file next to the destination, so an interrupted transfer can be
+// resumed by a later connection or a later run, with a Range request or from an offset for links
+// read through a hoster's Opener. Downloads that ask for
+// several segments are fetched over parallel range requests when the server allows it.
+func (m *Manager) transfer(ctx context.Context, dl *model.Download) (*transferResult, error) {
+	st := &transferState{}
+	st.total.Store(-1)
+	if dl.SpeedLimit != nil && *dl.SpeedLimit > 0 {
+		st.limiter = NewLimiter(*dl.SpeedLimit)
+	}
+	var expected string
+	if dl.Checksum != nil {
+		expected = *dl.Checksum
+	}
+	st.hasher = newFileHasher(expected)
+	defer m.unreserve(dl.ID)
+	if name := knownFilename(dl); name != "" {
+		st.dest = m.destination(dl, name)
+	}
+
+	if err := m.resolve(ctx, dl, st); err != nil {
+		return nil, err
+	}
+
+	stop := m.reportProgress(dl.ID, st)
+	err := m.download(ctx, dl, st)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+
+	part := st.dest + partSuffix
+	if err := st.hasher.syncTo(part, st.written.Load()); err != nil {
+		return nil, permanentError(CodeFilesystem, fmt.Errorf("failed to hash file: %w", err))
+	}
+	if expected != "" {
+		if err := st.hasher.verify(expected); err != nil {
+			// The content is wrong: make sure a retry downloads it again rather than resuming.
+			os.Remove(part)
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(part, st.dest); err != nil {
+		return nil, permanentError(CodeFilesystem, fmt.Errorf("failed to finalize file: %w", err))
+	}
+	return &transferResult{Path: st.dest, Hash: st.hasher.sum(fileHashAlgo)}, nil
+}
+
+// newRequest builds a GET request for the direct URL, with the headers the hoster asked for.
+func (st *transferState) newRequest(ctx context.Context) (*http.Request, error) {
+	link, header := st.link()
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, permanentError(CodeInvalidURL, fmt.Errorf("invalid URL: %w", err))
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+// link returns the direct URL and its headers.
+func (st *transferState) link() (string, http.Header) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.url, st.header
+}
+
+// httpError is httpError for the direct URL: a link handed out by the hoster that is refused
+// or gone may only have expired, so it is worth reconnecting, with a new link, before giving up.
+func (st *transferState) httpError(resp *http.Response) error {
+	err := httpError(resp)
+	if st.hoster != nil && (err.Code == CodeForbidden || err.Code == CodeNotFound) {
+		return &interruptedError{err}
+	}
+	return err
+}
+
+// relink asks the hoster for a new direct URL before reconnecting, as the one handed out may
+// have expired, like 1fichier's one-time links. stale is the URL the dropped connection used:
+// when another connection has already replaced it, it is kept.
+func (m *Manager) relink(ctx context.Context, dl *model.Download, st *transferState, stale string) error {
+	if st.hoster == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.url != stale {
+		return nil
+	}
+	link, err := st.hoster.Resolve(ctx, dl.URL, st.opts)
+	if err != nil {
+		return classifyHoster(fmt.Errorf("%s: %w", st.hoster.Name(), err))
+	}
+	st.url, st.header = link.URL, link.Header
+	return nil
+}
+
+// connectError classifies a request that got no response. A redirect refused by
+// integration.CheckRedirect fails the download for good; anything else is worth reconnecting for.
+func connectError(err error) error {
+	if errors.Is(err, integration.ErrUnsafeRedirect) {
+		return permanentError(CodeHTTP, err)
+	}
+	return &interruptedError{fmt.Errorf("network error: %w", err)}
+}
+
+// download fills the .part file, over several segments when asked and possible, otherwise over
+// a single connection that reconnects and resumes when it drops.
+func (m *Manager) download(ctx context.Context, dl *model.Download, st *transferState) error {
+	if n := segmentCount(ctx, dl); n > 1 && st.opener == nil {
+		err := m.fetchSegmented(ctx, dl, st, n)
+		if !errors.Is(err, errRangesUnsupported) {
+			return err
+		}
+		log.Printf("downloader: download %d: %v, falling back to a single connection", dl.ID, err)
+	}
+	if st.dest != "" {
+		if _, err := os.Stat(st.dest + segmentsSuffix); err == nil {
+			// A segmented .part file has holes and cannot be resumed sequentially.
+			os.Remove(st.dest + partSuffix)
+			os.Remove(st.dest + segmentsSuffix)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		stale, _ := st.link()
+		err := m.fetch(ctx, dl, st)
+		if err == nil {
+			return nil
+		}
+
+		var interrupted *interruptedError
+		if !errors.As(err, &interrupted) || attempt >= maxReconnects || ctx.Err() != nil {
+			return err
+		}
+		if !st.resumable && st.dest != "" {
+			// Without range support the partial data is useless: start over cleanly.
+			os.Remove(st.dest + partSuffix)
+		}
+		log.Printf("downloader: download %d: %v, reconnecting (%d/%d)", dl.ID, err, attempt, maxReconnects-1)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * reconnectDelay):
+		}
+		if err := m.relink(ctx, dl, st, stale); err != nil {
+			return err
+		}
+	}
+}
+
+// fetch opens one connection and appends whatever it receives to the .part file.
+func (m *Manager) fetch(ctx context.Context, dl *model.Download, st *transferState) error {
+	if st.opener != nil {
+		return m.fetchStream(ctx, dl, st)
+	}
+	var offset int64
+	if st.dest != "" {
+		if info, err := os.Stat(st.dest + partSuffix); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	req, err := st.newRequest(ctx)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return connectError(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return transientError(CodeServer, fmt.Errorf("server returned an unexpected range: %q", resp.Header.Get("Content-Range")))
+		}
+		st.resumable = true
+		st.total.Store(total)
+	case resp.StatusCode == http.StatusOK:
+		// Either a fresh start or the server ignored our Range header: restart from zero.
+		offset = 0
+		st.resumable = resp.Header.Get("Accept-Ranges") == "bytes"
+		st.total.Store(resp.ContentLength)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The .part file may already hold the whole file.
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			st.total.Store(total)
+			st.written.Store(offset)
+			return nil
+		}
+		os.Remove(st.dest + partSuffix)
+		return &interruptedError{fmt.Errorf("stale partial file discarded")}
+	default:
+		return st.httpError(resp)
+	}
+
+	if st.dest == "" {
+		st.dest = m.destination(dl, resolveFilename(dl, resp))
+	}
+	return m.writePart(ctx, dl, st, resp.Body, offset)
+}
+
+// fetchStream is fetch for links read through a hoster's Opener: it resumes from the end of the
+// .part file when the hoster can.
+func (m *Manager) fetchStream(ctx context.Context, dl *model.Download, st *transferState) error {
+	var offset int64
+	if st.dest != "" {
+		if info, err := os.Stat(st.dest + partSuffix); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	stream, err := st.opener.Open(ctx, st.url, offset, st.opts)
+	if err != nil {
+		err = classifyHoster(err)
+		var e *Error
+		if errors.As(err, &e) && !e.Permanent && e.RetryAfter == 0 {
+			return &interruptedError{err}
+		}
+		return err
+	}
+	defer stream.Close()
+
+	// A hoster that cannot resume starts over at 0, which truncates the .part file, so it never
+	// needs to be discarded between connections.
+	st.resumable = stream.Offset == offset
+	st.total.Store(stream.Size)
+	if offset > 0 && offset == stream.Size {
+		st.written.Store(offset)
+		return nil
+	}
+	if st.dest == "" {
+		name := knownFilename(dl)
+		if name == "" && stream.Filename != "" {
+			name = episodeName(dl, sanitizeFilename(stream.Filename))
+		}
+		if name == "" {
+			name = fmt.Sprintf("download-%d", dl.ID)
+		}
+		st.dest = m.destination(dl, name)
+	}
+	return m.writePart(ctx, dl, st, stream, stream.Offset)
+}
+
+// writePart writes r to the .part file, after the first offset bytes already there (truncating
+// it when offset is 0), and checks that the file ends up with the expected size.
+func (m *Manager) writePart(ctx context.Context, dl *model.Download, st *transferState, r io.Reader, offset int64) error {
+	var size *int64
+	if total := st.total.Load(); total >= 0 {
+		size = &total
+	}
+	if err := prepareDestination(ctx, dl.ID, st.dest, size); err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(st.dest+partSuffix, flags, 0o644)
+	if err != nil {
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to open partial file: %w", err))
+	}
+
+	// Bring the hasher in line with what is already on disk so it can keep hashing as data streams in.
+	if err := st.hasher.syncTo(st.dest+partSuffix, offset); err != nil {
+		f.Close()
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to hash partial file: %w", err))
+	}
+
+	st.written.Store(offset)
+	_, err = io.Copy(io.MultiWriter(f, &countingWriter{&st.written}, st.hasher), m.throttle(ctx, r, st))
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to write partial file: %w", closeErr))
+	}
+	if err != nil {
+		return &interruptedError{err}
+	}
+
+	if total := st.total.Load(); total >= 0 && st.written.Load() != total {
+		return &interruptedError{fmt.Errorf("received %d of %d bytes", st.written.Load(), total)}
+	}
+	return nil
+}
+
+// throttle applies the global limiter and the download's own cap to a response body or stream.
+func (m *Manager) throttle(ctx context.Context, r io.Reader, st *transferState) io.Reader {
+	return throttle(ctx, r, m.limiter, st.limiter)
+}
+
+// destination reserves the final path of a download named name in its target directory. A name
+// already taken by a finished file, by another download's partial file or by another running
+// transfer gets a " (n)" suffix, so downloads of files with the same name never write into each
+// other. The reservation lasts until unreserve.
+func (m *Manager) destination(dl *model.Download, name string) string {
+	dir := targetDir(dl)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n := 0; ; n++ {
+		candidate := numberedName(name, n)
+		dest := filepath.Join(dir, candidate)
+		if owner, ok := m.reserved[dest]; ok && owner != dl.ID {
+			continue
+		}
+		if !ownsFiles(dl, candidate) && (exists(dest) || exists(dest+partSuffix) || exists(dest+segmentsSuffix)) {
+			continue
+		}
+		m.reserved[dest] = dl.ID
+		return dest
+	}
+}
+
+// unreserve releases the paths reserved by a download.
+func (m *Manager) unreserve(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dest, owner := range m.reserved {
+		if owner == id {
+			delete(m.reserved, dest)
+		}
+	}
+}
+
+// ownsFiles reports whether the files named name were written by an earlier run of the download:
+// the name is the one it recorded and it has data on disk.
+func ownsFiles(dl *model.Download, name string) bool {
+	return dl.Filename != nil && sanitizeFilename(*dl.Filename) == name && dl.Downloaded > 0
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// numberedName returns name with " (n)" inserted before its extension, or name itself for n = 0.
+func numberedName(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// isNumbered reports whether name is base or a numbered variant of it given by destination.
+func isNumbered(name, base string) bool {
+	if name == base {
+		return true
+	}
+	ext := filepath.Ext(base)
+	stem, found := strings.CutPrefix(name, strings.TrimSuffix(base, ext)+" (")
+	if !found {
+		return false
+	}
+	n, found := strings.CutSuffix(stem, ")"+ext)
+	if !found {
+		return false
+	}
+	_, err := strconv.Atoi(n)
+	return err == nil
+}
+
+// recordFile and recordProgress write the state of a running transfer to its row. They are
+// variables so tests can run transfers without a database.
+var (
+	recordFile = func(ctx context.Context, id int, name string, size *int64) error {
+		_, err := database.Pool.Exec(ctx, "UPDATE downloads SET filename=$1, size=$2, updated_at=NOW() WHERE id=$3",
+			name, size, id)
+		return err
+	}
+	// Only a row still downloading is updated, so a pause or cancel is not overwritten with a speed and ETA.
+	recordProgress = func(id, progress int, written int64, speed int, eta *int) error {
+		_, err := database.Pool.Exec(context.Background(),
+			"UPDATE downloads SET progress=$1, downloaded=$2, speed=$3, eta=$4, updated_at=NOW() WHERE id=$5 AND status=$6",
+			progress, written, speed, eta, id, model.StatusDownloading)
+		return err
+	}
+)
+
+// prepareDestination creates the target directory and records the resolved filename and size on the row.
+func prepareDestination(ctx context.Context, id int, dest string, size *int64) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return permanentError(CodeFilesystem, fmt.Errorf("failed to create target directory: %w", err))
+	}
+	if err := recordFile(ctx, id, filepath.Base(dest), size); err != nil {
+		log.Printf("downloader: failed to record filename for download %d: %v", id, err)
+	}
+	return nil
+}
+
+// parseContentRange extracts the first byte and the complete length from a Content-Range header
+// such as "bytes 100-199/200" or "bytes */200".
+func parseContentRange(header string) (start, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	total, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if rng == "*" {
+		return 0, total, true
+	}
+	first, _, _ := strings.Cut(rng, "-")
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+func targetDir(dl *model.Download) string {
+	if dl.TargetPath != nil && *dl.TargetPath != "" {
+		return *dl.TargetPath
+	}
+	return DownloadDir()
+}
+
+// knownFilename returns the name a download will be saved under when it is known before
+// contacting the server: the user's custom name, possibly numbered by an earlier run, or the
+// name recorded by an earlier run.
+func knownFilename(dl *model.Download) string {
+	if dl.CustomFilename != nil && *dl.CustomFilename != "" {
+		name := sanitizeFilename(*dl.CustomFilename)
+		if dl.Filename != nil && isNumbered(sanitizeFilename(*dl.Filename), name) {
+			return sanitizeFilename(*dl.Filename)
+		}
+		return name
+	}
+	if dl.Filename != nil && *dl.Filename != "" {
+		return sanitizeFilename(*dl.Filename)
+	}
+	return ""
+}
+
+// resolveFilename picks, in order, a name known before the request, the server's
+// Content-Disposition and finally the last segment of the URL path. Episodes of a series are
+// named after the show, keeping the extension of the server's name.
+func resolveFilename(dl *model.Download, resp *http.Response) string {
+	if name := knownFilename(dl); name != "" {
+		return name
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return episodeName(dl, sanitizeFilename(params["filename"]))
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "/" && name != "." {
+		return episodeName(dl, sanitizeFilename(name))
+	}
+	return fmt.Sprintf("download-%d", dl.ID)
+}
+
+// episodeName renames a file of a download tagged as an episode after its show, e.g. when its
+// link was unwrapped from a protector only once the transfer started. Other names are kept.
+func episodeName(dl *model.Download, name string) string {
+	if dl.Show == nil || dl.Season == nil || dl.Episode == nil {
+		return name
+	}
+	if episode := EpisodeFilename(*dl.Show, *dl.Season, *dl.Episode, name); episode != "" {
+		return episode
+	}
+	return name
+}
+
+// EpisodeFilename names an episode "Show - S01E02", Plex's naming, keeping the extension of
+// name. It returns "" when name has no extension.
+func EpisodeFilename(show string, season, episode int, name string) string {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s - S%02dE%02d%s", SanitizeName(show), season, episode, ext)
+}
+
+// SanitizeName drops the characters that cannot appear in file and folder names on common filesystems.
+func SanitizeName(name string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return -1
+		}
+		return r
+	}, name))
+}
+
+// sanitizeFilename strips any directory components so a name can never escape the target directory.
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "download"
+	}
+	return name
+}
+
+type countingWriter struct {
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// reportProgress periodically writes progress, bytes written, speed and ETA for a running transfer.
+// The returned function stops the reporter, after a last write, and waits for it to exit.
+func (m *Manager) reportProgress(id int, st *transferState) func() {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		last := int64(-1)
+		lastAt := time.Now()
+		for {
+			var now time.Time
+			select {
+			case <-done:
+				// Record how much is on disk, so a later run knows the partial file is its own.
+				now = time.Now()
+				last = -1
+			case now = <-ticker.C:
+			}
+
+			written, total := st.written.Load(), st.total.Load()
+			speed := 0
+			// The first sample, and any restart from zero, only sets the baseline.
+			if last >= 0 && written >= last {
+				speed = int(float64(written-last) / now.Sub(lastAt).Seconds())
+			}
+			last, lastAt = written, now
+
+			progress := 0
+			var eta *int
+			if total > 0 {
+				progress = int(written * 100 / total)
+				if speed > 0 {
+					remaining := int((total - written) / int64(speed))
+					eta = &remaining
+				}
+			}
+
+			if err := recordProgress(id, progress, written, speed, eta); err != nil {
+				log.Printf("downloader: failed to update progress for download %d: %v", id, err)
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
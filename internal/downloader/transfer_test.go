@@ -0,0 +1,273 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/gautch29/downloader-backend/internal/integration/direct"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// testManager returns a manager whose transfers do not touch the database.
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+	savedFile, savedProgress, savedDelay := recordFile, recordProgress, reconnectDelay
+	recordFile = func(context.Context, int, string, *int64) error { return nil }
+	recordProgress = func(int, int, int64, int, *int) error { return nil }
+	reconnectDelay = 10 * time.Millisecond
+	t.Cleanup(func() {
+		recordFile, recordProgress, reconnectDelay = savedFile, savedProgress, savedDelay
+	})
+	return NewManager(1, BandwidthSchedule{}, ActiveHours{})
+}
+
+func testData(size int) []byte {
+	r := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(r.Uint32())
+	}
+	return data
+}
+
+// serveFile serves data at any path. The first response drops the connection after cut bytes
+// when cut > 0; Range requests are answered only when ranges is set.
+func serveFile(t *testing.T, data []byte, cut int, ranges bool) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		body := data
+		var start int
+		if ranges {
+			w.Header().Set("Accept-Ranges", "bytes")
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil {
+				body = data[start:]
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			}
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		if start > 0 {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		if n == 1 && cut > 0 {
+			w.Write(body[:cut])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func newDownload(t *testing.T, rawURL string) *model.Download {
+	dir := t.TempDir()
+	return &model.Download{ID: 1, URL: rawURL, TargetPath: &dir}
+}
+
+func checkFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s: got %d bytes, differing from the %d bytes served", path, len(got), len(want))
+	}
+	if _, err := os.Stat(path + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", path+partSuffix)
+	}
+}
+
+func TestTransferResumesDroppedConnection(t *testing.T) {
+	m := testManager(t)
+	data := testData(256 << 10)
+	srv, requests := serveFile(t, data, 100<<10, true)
+	dl := newDownload(t, srv.URL+"/file.bin")
+
+	result, err := m.transfer(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != filepath.Join(*dl.TargetPath, "file.bin") {
+		t.Errorf("path = %s", result.Path)
+	}
+	checkFile(t, result.Path, data)
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestTransferRestartsWhenRangeIgnored(t *testing.T) {
+	m := testManager(t)
+	data := testData(256 << 10)
+	srv, requests := serveFile(t, data, 100<<10, false)
+	dl := newDownload(t, srv.URL+"/file.bin")
+
+	result, err := m.transfer(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, result.Path, data)
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestTransferResumesPartFile(t *testing.T) {
+	m := testManager(t)
+	data := testData(256 << 10)
+	const have = 64 << 10
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	dl := newDownload(t, srv.URL+"/file.bin")
+	name := "file.bin"
+	dl.Filename, dl.Downloaded = &name, have
+	dest := filepath.Join(*dl.TargetPath, name)
+	if err := os.WriteFile(dest+partSuffix, data[:have], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := m.transfer(context.Background(), dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, result.Path, data)
+	if len(ranges) != 1 || ranges[0] != fmt.Sprintf("bytes=%d-", have) {
+		t.Errorf("Range headers = %q", ranges)
+	}
+}
+
+func TestTransferKeepsSameNamesApart(t *testing.T) {
+	m := testManager(t)
+	first, second := testData(64<<10), testData(32<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := first
+		if r.URL.Path == "/b/video.mkv" {
+			data = second
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	a := newDownload(t, srv.URL+"/a/video.mkv")
+	b := &model.Download{ID: 2, URL: srv.URL + "/b/video.mkv", TargetPath: a.TargetPath}
+	// Another download's partial file is not resumed either.
+	os.WriteFile(filepath.Join(*a.TargetPath, "video (1).mkv"+partSuffix), []byte("other"), 0o644)
+
+	ra, err := m.transfer(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb, err := m.transfer(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, ra.Path, first)
+	if want := filepath.Join(*a.TargetPath, "video (2).mkv"); rb.Path != want {
+		t.Fatalf("second path = %s, want %s", rb.Path, want)
+	}
+	checkFile(t, rb.Path, second)
+}
+
+func TestDestinationReservesRunningPaths(t *testing.T) {
+	m := testManager(t)
+	dir := t.TempDir()
+	a := &model.Download{ID: 1, TargetPath: &dir}
+	b := &model.Download{ID: 2, TargetPath: &dir}
+
+	if got := m.destination(a, "video.mkv"); got != filepath.Join(dir, "video.mkv") {
+		t.Errorf("first = %s", got)
+	}
+	if got := m.destination(b, "video.mkv"); got != filepath.Join(dir, "video (1).mkv") {
+		t.Errorf("second = %s", got)
+	}
+	m.unreserve(a.ID)
+	if got := m.destination(b, "video.mkv"); got != filepath.Join(dir, "video.mkv") {
+		t.Errorf("after release = %s", got)
+	}
+}
+
+func TestKnownFilenameKeepsNumberedName(t *testing.T) {
+	custom, recorded := "Movie.mkv", "Movie (2).mkv"
+	dl := &model.Download{CustomFilename: &custom, Filename: &recorded}
+	if got := knownFilename(dl); got != recorded {
+		t.Errorf("knownFilename = %q, want %q", got, recorded)
+	}
+	other := "movie.1080p.mkv"
+	dl.Filename = &other
+	if got := knownFilename(dl); got != custom {
+		t.Errorf("knownFilename = %q, want %q", got, custom)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header       string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 0-99/200", 0, 200, true},
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes */200", 0, 200, true},
+		{"bytes 100-199/*", 0, 0, false},
+		{"bytes abc-199/200", 0, 0, false},
+		{"items 0-99/200", 0, 0, false},
+		{"bytes 0-99", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.header)
+		if start != tt.start || total != tt.total || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d, %v",
+				tt.header, start, total, ok, tt.start, tt.total, tt.ok)
+		}
+	}
+}
+
+func TestRemoveFilesKeepsOtherDownloadsFiles(t *testing.T) {
+	dir := t.TempDir()
+	name := "video.mkv"
+	dest := filepath.Join(dir, name)
+	for _, path := range []string{dest, dest + partSuffix, dest + segmentsSuffix} {
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Both rows were named from the hoster when queued; only started has written anything.
+	queued := &model.Download{ID: 1, Filename: &name, TargetPath: &dir, Destination: model.DestinationLocal}
+	remote := &model.Download{ID: 2, Filename: &name, TargetPath: &dir, Destination: model.DestinationOneFichier, Downloaded: 4}
+	started := &model.Download{ID: 3, Filename: &name, TargetPath: &dir, Destination: model.DestinationLocal, Downloaded: 4}
+
+	for _, dl := range []*model.Download{queued, remote} {
+		if err := RemoveFiles(dl, true); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{dest, dest + partSuffix, dest + segmentsSuffix} {
+			if !exists(path) {
+				t.Fatalf("download %d removed %s", dl.ID, path)
+			}
+		}
+	}
+
+	if err := RemoveFiles(started, false); err != nil {
+		t.Fatal(err)
+	}
+	if exists(dest+partSuffix) || exists(dest+segmentsSuffix) || !exists(dest) {
+		t.Error("partial files of the started download not removed, or the finished file removed")
+	}
+}
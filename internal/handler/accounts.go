@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gautch29/downloader-backend/internal/downloader"
+	"github.com/gautch29/downloader-backend/internal/integration/onefichier"
+)
+
+type OneFichierAccountResponse struct {
+	*onefichier.AccountInfo
+	// QueueHold is why the queue is not starting downloads, e.g. not enough traffic left.
+	QueueHold string `json:"queueHold,omitempty"`
+}
+
+// GetOneFichierAccount returns the premium status and remaining traffic of the configured 1fichier account.
+func GetOneFichierAccount(w http.ResponseWriter, r *http.Request) {
+	info, err := onefichier.NewClient(os.Getenv("ONEFICHIER_API_KEY")).AccountInfo(r.Context())
+	if err != nil {
+		respondHosterError(w, err, "Failed to fetch 1fichier account")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, OneFichierAccountResponse{AccountInfo: info, QueueHold: downloader.HoldReason()})
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/model"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/ssh"
+)
+
+// ListCredentials returns the saved FTP and SFTP logins, without their secrets.
+func ListCredentials(w http.ResponseWriter, r *http.Request) {
+	rows, err := database.Pool.Query(r.Context(),
+		"SELECT id, protocol, host, username, host_key, created_at FROM credentials ORDER BY protocol, host")
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to fetch credentials")
+		return
+	}
+	defer rows.Close()
+
+	credentials := []model.Credential{}
+	for rows.Next() {
+		var c model.Credential
+		if err := rows.Scan(&c.ID, &c.Protocol, &c.Host, &c.Username, &c.HostKey, &c.CreatedAt); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to scan credential")
+			return
+		}
+		credentials = append(credentials, c)
+	}
+
+	RespondJSON(w, http.StatusOK, credentials)
+}
+
+type SaveCredentialRequest struct {
+	Protocol   string `json:"protocol"`
+	Host       string `json:"host"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	PrivateKey string `json:"privateKey"`
+	HostKey    string `json:"hostKey"`
+}
+
+// SaveCredential stores the login used for ftp:// or sftp:// links to a host, replacing the
+// one already saved for the same protocol and host. A host key pinned earlier is kept unless
+// another one is given.
+func SaveCredential(w http.ResponseWriter, r *http.Request) {
+	var req SaveCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	req.Host = strings.ToLower(strings.TrimSpace(req.Host))
+	if req.Protocol != "ftp" && req.Protocol != "sftp" {
+		RespondError(w, http.StatusBadRequest, "Protocol must be ftp or sftp")
+		return
+	}
+	if req.Host == "" || strings.ContainsAny(req.Host, "/@ ") {
+		RespondError(w, http.StatusBadRequest, "Host must be a hostname or host:port")
+		return
+	}
+	if req.Protocol == "ftp" && (req.PrivateKey != "" || req.HostKey != "") {
+		RespondError(w, http.StatusBadRequest, "Private and host keys only apply to SFTP")
+		return
+	}
+	if req.PrivateKey != "" {
+		if _, err := ssh.ParsePrivateKey([]byte(req.PrivateKey)); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid private key: "+err.Error())
+			return
+		}
+	}
+	req.HostKey = strings.TrimSpace(req.HostKey)
+	if req.HostKey != "" {
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.HostKey)); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid host key: "+err.Error())
+			return
+		}
+	}
+
+	c := model.Credential{Protocol: req.Protocol, Host: req.Host, Username: req.Username, HostKey: req.HostKey}
+	err := database.Pool.QueryRow(r.Context(), `
+		INSERT INTO credentials (protocol, host, username, password, private_key, host_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (protocol, host) DO UPDATE SET
+			username=EXCLUDED.username, password=EXCLUDED.password,
+			private_key=EXCLUDED.private_key, host_key=COALESCE(NULLIF(EXCLUDED.host_key, ''), credentials.host_key)
+		RETURNING id, host_key, created_at`,
+		req.Protocol, req.Host, req.Username, req.Password, req.PrivateKey, req.HostKey,
+	).Scan(&c.ID, &c.HostKey, &c.CreatedAt)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to save credential")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, c)
+}
+
+// DeleteCredential removes a saved login.
+func DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	tag, err := database.Pool.Exec(r.Context(), "DELETE FROM credentials WHERE id=$1", id)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to delete credential")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		RespondError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
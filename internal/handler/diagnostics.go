@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gautch29/downloader-backend/internal/database"
-	"github.com/gautch29/downloader-backend/internal/integration/onefichier"
+	"github.com/gautch29/downloader-backend/internal/downloader"
+	"github.com/gautch29/downloader-backend/internal/integration"
 	"github.com/gautch29/downloader-backend/internal/integration/plex"
 	"github.com/gautch29/downloader-backend/internal/integration/zonetelechargement"
 	"github.com/gautch29/downloader-backend/internal/util"
@@ -14,7 +17,7 @@ import (
 
 type ValidationResult struct {
 	Service string `json:"service"`
-	Status  string `json:"status"` // "ok" or "error"
+	Status  string `json:"status"` // "ok", "warning", "error" or "skipped"
 	Message string `json:"message,omitempty"`
 }
 
@@ -34,14 +37,35 @@ func RunDiagnostics(w http.ResponseWriter, r *http.Request) {
 	}
 	checks = append(checks, dbCheck)
 
-	// 2. 1fichier Check
-	ofKey := os.Getenv("ONEFICHIER_API_KEY")
-	ofCheck := ValidationResult{Service: "1fichier", Status: "ok"}
-	if err := onefichier.NewClient(ofKey).CheckAPI(); err != nil {
-		ofCheck.Status = "error"
-		ofCheck.Message = err.Error()
+	// 2. Hoster Checks
+	for _, h := range integration.Hosters() {
+		check := ValidationResult{Service: h.Name(), Status: "ok"}
+		if status, err := h.Check(r.Context()); errors.Is(err, integration.ErrRateLimited) {
+			// The credentials may well be fine; the hoster just refuses calls for now.
+			check.Status = "warning"
+			check.Message = "Rate limited: " + err.Error()
+		} else if errors.Is(err, integration.ErrNotChecked) {
+			// Nothing was verified, which says nothing about whether the hoster works.
+			check.Status = "skipped"
+			check.Message = err.Error()
+		} else if errors.Is(err, integration.ErrUnauthorized) {
+			check.Status = "error"
+			check.Message = "Invalid or missing credentials: " + err.Error()
+		} else if err != nil {
+			check.Status = "error"
+			check.Message = err.Error()
+		} else {
+			check.Message = status
+		}
+		checks = append(checks, check)
+	}
+
+	queueCheck := ValidationResult{Service: "Download queue", Status: "ok"}
+	if hold := downloader.HoldReason(); hold != "" {
+		queueCheck.Status = "warning"
+		queueCheck.Message = "Held: " + hold
 	}
-	checks = append(checks, ofCheck)
+	checks = append(checks, queueCheck)
 
 	// 3. Plex Check
 	plexUrl := ""   // TODO: Fetch from settings DB
@@ -74,14 +98,33 @@ func RunDiagnostics(w http.ResponseWriter, r *http.Request) {
 	checks = append(checks, plexCheck)
 
 	// 4. Zone-Telechargement Check
+	// A domain that moved is replaced by the one it redirects to or by a mirror that answers.
 	ztCheck := ValidationResult{Service: "Zone-Telechargement", Status: "ok"}
-	if err := zonetelechargement.CheckConnectivity(); err != nil {
+	domain, changed, err := zonetelechargement.CheckConnectivity(r.Context())
+	ztCheck.Message = "Using " + domain.URL
+	if !domain.ChangedAt.IsZero() {
+		ztCheck.Message += ", since " + domain.ChangedAt.Format(time.RFC3339)
+	}
+	if err != nil {
 		ztCheck.Status = "error"
-		ztCheck.Message = err.Error()
+		ztCheck.Message += ": " + err.Error()
+	} else if changed {
+		ztCheck.Status = "warning"
+		ztCheck.Message += " (the previous domain stopped answering)"
 	}
 	checks = append(checks, ztCheck)
 
-	// 5. Disk Space (Check paths from DB)
+	// 5. Scraper cache: counts since the server started
+	stats := zonetelechargement.Stats()
+	cacheCheck := ValidationResult{Service: "Scraper cache", Status: "ok"}
+	cacheCheck.Message = fmt.Sprintf("%d hits, %d misses", stats.Hits, stats.Misses)
+	if total := stats.Hits + stats.Misses; total > 0 {
+		cacheCheck.Message += fmt.Sprintf(" (%.0f%% hit rate)", float64(stats.Hits)*100/float64(total))
+	}
+	cacheCheck.Message += fmt.Sprintf(", %d pages in memory", stats.Entries)
+	checks = append(checks, cacheCheck)
+
+	// 6. Disk Space (Check paths from DB)
 	diskSpace := make(map[string]string)
 	pathRows, _ := database.Pool.Query(r.Context(), "SELECT name, path FROM paths")
 	defer pathRows.Close()
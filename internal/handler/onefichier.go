@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gautch29/downloader-backend/internal/integration/onefichier"
+)
+
+// ListOneFichierFiles browses the folders and files stored in the 1fichier account.
+// ?folderId= selects the folder, the root folder by default.
+func ListOneFichierFiles(w http.ResponseWriter, r *http.Request) {
+	folderID := 0
+	if v := r.URL.Query().Get("folderId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			RespondError(w, http.StatusBadRequest, "Invalid folderId")
+			return
+		}
+		folderID = id
+	}
+
+	folder, err := onefichier.NewClient(os.Getenv("ONEFICHIER_API_KEY")).ListAccountFolder(r.Context(), folderID)
+	if err != nil {
+		respondHosterError(w, err, "Failed to list 1fichier folder")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, folder)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/downloader"
+	"github.com/gautch29/downloader-backend/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// ListPackages returns the packages with totals over their downloads, newest first.
+// The downloads themselves are listed with GET /downloads?packageId=.
+func ListPackages(w http.ResponseWriter, r *http.Request) {
+	rows, err := database.Pool.Query(r.Context(), `
+		SELECT p.id, p.name, p.created_at,
+			COUNT(d.id),
+			COUNT(d.id) FILTER (WHERE d.status=$1),
+			COUNT(d.id) FILTER (WHERE d.status=$2),
+			COALESCE(SUM(d.size), 0),
+			COALESCE(SUM(d.downloaded), 0)
+		FROM packages p
+		LEFT JOIN downloads d ON d.package_id = p.id
+		GROUP BY p.id
+		ORDER BY p.created_at DESC, p.id DESC`, model.StatusCompleted, model.StatusError)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to fetch packages")
+		return
+	}
+	defer rows.Close()
+
+	packages := []model.Package{}
+	for rows.Next() {
+		var p model.Package
+		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt, &p.Files, &p.Completed, &p.Failed, &p.Size, &p.Downloaded); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to scan package")
+			return
+		}
+		packages = append(packages, p)
+	}
+
+	RespondJSON(w, http.StatusOK, packages)
+}
+
+// DeletePackage removes a package and all of its downloads, stopping running transfers.
+// With ?deleteFiles=true their partial or completed files are removed from disk as well.
+func DeletePackage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	deleteFiles := r.URL.Query().Get("deleteFiles") == "true"
+
+	ctx := r.Context()
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		"DELETE FROM downloads WHERE package_id=$1 RETURNING id, filename, custom_filename, target_path, destination, downloaded", id)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to delete downloads")
+		return
+	}
+	var downloads []model.Download
+	for rows.Next() {
+		var dl model.Download
+		if err := rows.Scan(&dl.ID, &dl.Filename, &dl.CustomFilename, &dl.TargetPath, &dl.Destination, &dl.Downloaded); err != nil {
+			rows.Close()
+			RespondError(w, http.StatusInternalServerError, "Failed to delete downloads")
+			return
+		}
+		downloads = append(downloads, dl)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to delete downloads")
+		return
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM packages WHERE id=$1", id)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to delete package")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		RespondError(w, http.StatusNotFound, "Package not found")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to commit changes")
+		return
+	}
+
+	var failed int
+	for i := range downloads {
+		downloader.Stop(downloads[i].ID)
+		if deleteFiles {
+			if err := downloader.RemoveFiles(&downloads[i], true); err != nil {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		RespondError(w, http.StatusInternalServerError,
+			"Package deleted but failed to remove the files of "+strconv.Itoa(failed)+" download(s)")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/downloader"
+	"github.com/gautch29/downloader-backend/internal/model"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type UpdateDownloadRequest struct {
+	Priority *int `json:"priority"`
+}
+
+// UpdateDownload changes the editable fields of a download. Omitted fields are left unchanged.
+func UpdateDownload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var req UpdateDownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var dl model.Download
+	err = scanDownload(database.Pool.QueryRow(r.Context(), `
+		UPDATE downloads SET priority=COALESCE($1, priority), updated_at=NOW()
+		WHERE id=$2
+		RETURNING `+downloadColumns, req.Priority, id), &dl)
+	if err == pgx.ErrNoRows {
+		RespondError(w, http.StatusNotFound, "Download not found")
+		return
+	} else if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to update download")
+		return
+	}
+
+	downloader.Wake()
+	RespondJSON(w, http.StatusOK, dl)
+}
+
+type MoveDownloadRequest struct {
+	Position string `json:"position"` // "top" or "bottom"
+}
+
+// MoveDownload puts a waiting download at the top or bottom of the queue. Moving to the top
+// raises its priority to the highest in the queue; moving to the bottom lowers it to the lowest.
+func MoveDownload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var req MoveDownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var query string
+	switch req.Position {
+	case "top":
+		query = `
+			UPDATE downloads SET priority=GREATEST(downloads.priority, q.p), sort_order=q.s - 1, updated_at=NOW()
+			FROM (SELECT MAX(priority) AS p, MIN(sort_order) AS s FROM downloads WHERE status = ANY($2)) q
+			WHERE id=$1 AND status = ANY($2)`
+	case "bottom":
+		query = `
+			UPDATE downloads SET priority=LEAST(downloads.priority, q.p), sort_order=q.s + 1, updated_at=NOW()
+			FROM (SELECT MIN(priority) AS p, MAX(sort_order) AS s FROM downloads WHERE status = ANY($2)) q
+			WHERE id=$1 AND status = ANY($2)`
+	default:
+		RespondError(w, http.StatusBadRequest, `position must be "top" or "bottom"`)
+		return
+	}
+
+	tag, err := database.Pool.Exec(r.Context(), query, id, downloader.WaitingStatuses)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to move download")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		RespondError(w, http.StatusConflict, "Download not found in the queue")
+		return
+	}
+
+	downloader.Wake()
+	RespondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+type ReorderQueueRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// ReorderQueue rewrites the queue so the listed waiting downloads start in the given order.
+// Their priorities are reset to 0 so the given order is the effective one; waiting downloads
+// that are not listed keep their relative order after the listed ones of equal priority.
+func ReorderQueue(w http.ResponseWriter, r *http.Request) {
+	var req ReorderQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.IDs) == 0 {
+		RespondError(w, http.StatusBadRequest, "ids must not be empty")
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Listed rows get consecutive sort keys below every existing one.
+	var base float64
+	if err := tx.QueryRow(ctx, "SELECT COALESCE(MIN(sort_order), 0) FROM downloads WHERE status = ANY($1)",
+		downloader.WaitingStatuses).Scan(&base); err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to read queue")
+		return
+	}
+	base -= float64(len(req.IDs))
+
+	for i, id := range req.IDs {
+		tag, err := tx.Exec(ctx,
+			"UPDATE downloads SET priority=0, sort_order=$1, updated_at=NOW() WHERE id=$2 AND status = ANY($3)",
+			base+float64(i), id, downloader.WaitingStatuses)
+		if err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to reorder queue")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			RespondError(w, http.StatusConflict, "Download "+strconv.Itoa(id)+" not found in the queue")
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to commit changes")
+		return
+	}
+
+	downloader.Wake()
+	RespondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
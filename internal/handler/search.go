@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gautch29/downloader-backend/internal/downloader"
+	"github.com/gautch29/downloader-backend/internal/integration/protector"
+	"github.com/gautch29/downloader-backend/internal/integration/zonetelechargement"
+)
+
+// Search looks releases up on Zone-Telechargement. ?q= is the query and ?type= is "movie"
+// (the default) or "series".
+func Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		RespondError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	category := zonetelechargement.Category(r.URL.Query().Get("type"))
+	switch category {
+	case "":
+		category = zonetelechargement.CategoryMovie
+	case zonetelechargement.CategoryMovie, zonetelechargement.CategorySeries:
+	default:
+		RespondError(w, http.StatusBadRequest, `type must be "movie" or "series"`)
+		return
+	}
+
+	client, err := zonetelechargement.NewDefaultClient(r.Context())
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	results, err := client.Search(r.Context(), query, category)
+	if err != nil {
+		respondHosterError(w, err, "Search failed")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, results)
+}
+
+// GetRelease lists the versions of a release found by a search, with their links grouped by
+// hoster. ?url= is the result's detailUrl.
+func GetRelease(w http.ResponseWriter, r *http.Request) {
+	pageURL := r.URL.Query().Get("url")
+	if pageURL == "" {
+		RespondError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	release, ok := fetchRelease(w, r.Context(), pageURL)
+	if !ok {
+		return
+	}
+	RespondJSON(w, http.StatusOK, release)
+}
+
+type QueueReleaseRequest struct {
+	URL string `json:"url"`
+	// Group is the index of the chosen version in the release's groups.
+	Group int `json:"group"`
+	// Hoster picks the hoster to download from, by name; 1fichier when listed, else the first one.
+	Hoster string `json:"hoster"`
+	// TargetPath defaults to a folder named after the release in the download directory.
+	TargetPath string `json:"targetPath"`
+	Priority   int    `json:"priority"`
+}
+
+type QueueReleaseResponse struct {
+	AddDownloadResponse
+	TargetPath string `json:"targetPath"`
+	// Filename is the name given to a single-file release, when its extension is known.
+	Filename string `json:"filename,omitempty"`
+}
+
+// QueueRelease queues one version of a release from one hoster. A single file is named after the
+// release, e.g. "Oppenheimer (2023).mkv"; the parts or episodes of a version are grouped in a
+// package and keep their own names.
+func QueueRelease(w http.ResponseWriter, r *http.Request) {
+	var req QueueReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.URL == "" {
+		RespondError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	ctx := r.Context()
+	release, ok := fetchRelease(w, ctx, req.URL)
+	if !ok {
+		return
+	}
+	if req.Group < 0 || req.Group >= len(release.Groups) {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("group must be between 0 and %d", len(release.Groups)-1))
+		return
+	}
+	group := release.Groups[req.Group]
+	hoster := pickHoster(group.Hosters, req.Hoster)
+	if hoster == nil {
+		RespondError(w, http.StatusUnprocessableEntity, "No links for this version from the chosen hoster")
+		return
+	}
+
+	name := releaseName(release)
+	resp := QueueReleaseResponse{TargetPath: req.TargetPath}
+	if resp.TargetPath == "" {
+		resp.TargetPath = filepath.Join(downloader.DownloadDir(), name)
+	}
+	add := AddDownloadRequest{
+		PackageName: fmt.Sprintf("%s %s %s", name, group.Quality, group.Language),
+		TargetPath:  resp.TargetPath,
+		Priority:    req.Priority,
+	}
+	if len(hoster.Links) == 1 {
+		// The link is unwrapped here so the file is looked up when queued, and named after the
+		// release with the extension the hoster reports. A link that fails to unwrap is queued
+		// as given and fails in the worker.
+		add.URL = hoster.Links[0].URL
+		if unwrapped, err := protector.Unwrap(ctx, add.URL); err == nil {
+			add.URL = unwrapped
+		}
+		add.nameAfter = name
+	} else {
+		for _, link := range hoster.Links {
+			add.URLs = append(add.URLs, link.URL)
+		}
+	}
+
+	queued, ok := queueDownloads(w, r, add)
+	if !ok {
+		return
+	}
+	resp.AddDownloadResponse = *queued
+	resp.Filename = queued.filename
+	RespondJSON(w, http.StatusCreated, resp)
+}
+
+type QueueSeasonRequest struct {
+	URL string `json:"url"`
+	// Group is the index of the chosen version in the release's groups.
+	Group int `json:"group"`
+	// Hoster picks the hoster to download from, by name; 1fichier when listed, else the first one.
+	Hoster string `json:"hoster"`
+	// TargetPath defaults to "<Show>/Season NN" in the download directory.
+	TargetPath string `json:"targetPath"`
+	Priority   int    `json:"priority"`
+}
+
+type QueueSeasonResponse struct {
+	AddDownloadResponse
+	Show     string `json:"show"`
+	Season   int    `json:"season"`
+	Episodes []int  `json:"episodes"`
+	// MissingEpisodes are the episodes below the last one queued that have no link, e.g. while a
+	// season is still being released.
+	MissingEpisodes []int  `json:"missingEpisodes"`
+	TargetPath      string `json:"targetPath"`
+}
+
+// QueueSeason queues every episode of a series season in one version, one download per episode,
+// gathered from all the pages of that version. The downloads are grouped in a package and tagged
+// with the show, season and episode; files are named "Show - S01E02" when their extension is known.
+func QueueSeason(w http.ResponseWriter, r *http.Request) {
+	var req QueueSeasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.URL == "" {
+		RespondError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	release, ok := fetchRelease(w, r.Context(), req.URL)
+	if !ok {
+		return
+	}
+	if release.Season == 0 {
+		RespondError(w, http.StatusUnprocessableEntity, "Not a series season: "+release.Title)
+		return
+	}
+	if req.Group < 0 || req.Group >= len(release.Groups) {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("group must be between 0 and %d", len(release.Groups)-1))
+		return
+	}
+	group := release.Groups[req.Group]
+	hoster := pickHoster(group.Hosters, req.Hoster)
+	if hoster == nil {
+		RespondError(w, http.StatusUnprocessableEntity, "No links for this version from the chosen hoster")
+		return
+	}
+	episodes := release.Episodes(group, hoster.Hoster)
+	if len(episodes) == 0 {
+		RespondError(w, http.StatusUnprocessableEntity, "No episode links for this version from the chosen hoster")
+		return
+	}
+
+	season := release.Season
+	resp := QueueSeasonResponse{
+		Show:            release.Show,
+		Season:          season,
+		MissingEpisodes: zonetelechargement.MissingEpisodes(episodes),
+		TargetPath:      req.TargetPath,
+	}
+	if resp.TargetPath == "" {
+		resp.TargetPath = filepath.Join(downloader.DownloadDir(), downloader.SanitizeName(release.Show), fmt.Sprintf("Season %02d", season))
+	}
+	add := AddDownloadRequest{
+		PackageName: fmt.Sprintf("%s S%02d %s %s", release.Show, season, group.Quality, group.Language),
+		TargetPath:  resp.TargetPath,
+		Priority:    req.Priority,
+		Show:        release.Show,
+		Season:      &season,
+		episodes:    map[string]int{},
+	}
+	for _, e := range episodes {
+		add.URLs = append(add.URLs, e.URL)
+		add.episodes[e.URL] = e.Episode
+		resp.Episodes = append(resp.Episodes, e.Episode)
+	}
+
+	queued, ok := queueDownloads(w, r, add)
+	if !ok {
+		return
+	}
+	resp.AddDownloadResponse = *queued
+	RespondJSON(w, http.StatusCreated, resp)
+}
+
+// fetchRelease reads a release page, responding with the error when it fails.
+func fetchRelease(w http.ResponseWriter, ctx context.Context, pageURL string) (*zonetelechargement.Release, bool) {
+	client, err := zonetelechargement.NewDefaultClient(ctx)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	release, err := client.Release(ctx, pageURL)
+	if err != nil {
+		respondHosterError(w, err, "Failed to read release")
+		return nil, false
+	}
+	return release, true
+}
+
+// pickHoster returns the links from the named hoster, or by default from 1fichier when listed,
+// else from the first hoster.
+func pickHoster(hosters []zonetelechargement.HosterLinks, name string) *zonetelechargement.HosterLinks {
+	for i := range hosters {
+		if name != "" && strings.EqualFold(hosters[i].Hoster, name) {
+			return &hosters[i]
+		}
+	}
+	if name != "" || len(hosters) == 0 {
+		return nil
+	}
+	for i := range hosters {
+		if strings.Contains(strings.ToLower(hosters[i].Hoster), "1fichier") {
+			return &hosters[i]
+		}
+	}
+	return &hosters[0]
+}
+
+// releaseName is the name files and folders of a release are given: "Title (Year)".
+func releaseName(release *zonetelechargement.Release) string {
+	name := release.Title
+	if release.Year > 0 {
+		name = fmt.Sprintf("%s (%d)", name, release.Year)
+	}
+	if name = downloader.SanitizeName(name); name == "" {
+		return "release"
+	}
+	return name
+}
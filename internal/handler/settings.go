@@ -1,13 +1,42 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/downloader"
+	"github.com/gautch29/downloader-backend/internal/integration/onefichier"
+	"github.com/gautch29/downloader-backend/internal/integration/zonetelechargement"
 	"github.com/gautch29/downloader-backend/internal/model"
 )
 
+// settingDefaults are reported by GetSettings for engine settings that have never been saved.
+var settingDefaults = map[string]string{
+	downloader.SettingConcurrency:             strconv.Itoa(downloader.DefaultConcurrency),
+	downloader.SettingMaxSegments:             strconv.Itoa(downloader.DefaultMaxSegments),
+	downloader.SettingBandwidthLimit:          "0",
+	downloader.SettingBandwidthSchedule:       "[]",
+	downloader.SettingMaxAttempts:             strconv.Itoa(downloader.DefaultMaxAttempts),
+	downloader.SettingRetryBaseDelay:          strconv.Itoa(int(downloader.DefaultRetryBaseDelay.Seconds())),
+	downloader.SettingActiveHoursStart:        "",
+	downloader.SettingActiveHoursEnd:          "",
+	onefichier.SettingCDN:                     "false",
+	zonetelechargement.SettingBaseURL:         zonetelechargement.DefaultBaseURL,
+	zonetelechargement.SettingMirrors:         "[]",
+	zonetelechargement.SettingUserAgent:       zonetelechargement.DefaultUserAgent,
+	zonetelechargement.SettingProxy:           "",
+	zonetelechargement.SettingRequestInterval: strconv.Itoa(int(zonetelechargement.DefaultRequestInterval.Milliseconds())),
+	zonetelechargement.SettingSearchCacheTTL:  strconv.Itoa(int(zonetelechargement.DefaultSearchCacheTTL.Seconds())),
+	zonetelechargement.SettingReleaseCacheTTL: strconv.Itoa(int(zonetelechargement.DefaultReleaseCacheTTL.Seconds())),
+	zonetelechargement.SettingCachePersist:    "false",
+}
+
 type SettingsResponse struct {
 	Settings map[string]string `json:"settings"`
 	Paths    []model.Path      `json:"paths"`
@@ -30,6 +59,11 @@ func GetSettings(w http.ResponseWriter, r *http.Request) {
 		}
 		settingsMap[key] = value
 	}
+	for key, value := range settingDefaults {
+		if _, ok := settingsMap[key]; !ok {
+			settingsMap[key] = value
+		}
+	}
 
 	// Fetch Paths
 	pathRows, err := database.Pool.Query(r.Context(), "SELECT id, name, path FROM paths")
@@ -57,7 +91,33 @@ func GetSettings(w http.ResponseWriter, r *http.Request) {
 type UpdateSettingsRequest struct {
 	PlexURL   string `json:"plexUrl"`
 	PlexToken string `json:"plexToken"`
-	Paths     []struct {
+	// Optional: left unchanged when omitted
+	MaxConcurrentDownloads *int `json:"maxConcurrentDownloads"`
+	MaxSegments            *int `json:"maxSegments"`
+	// Global limit in bytes per second (0 = unlimited) and the time windows overriding it
+	BandwidthLimit    *int64                      `json:"bandwidthLimit"`
+	BandwidthSchedule *[]downloader.BandwidthRule `json:"bandwidthSchedule"`
+	// Retry policy: attempts per download and the first backoff delay in seconds
+	MaxAttempts    *int `json:"maxAttempts"`
+	RetryBaseDelay *int `json:"retryBaseDelay"`
+	// Daily "HH:MM" window for starting downloads; both empty means always
+	ActiveHoursStart *string `json:"activeHoursStart"`
+	ActiveHoursEnd   *string `json:"activeHoursEnd"`
+	// Serve 1fichier downloads from the CDN (uses the account's CDN credit)
+	OnefichierCDN *bool `json:"onefichierCdn"`
+	// Zone-Telechargement domain in use, and extra domains tried when it stops answering
+	ZoneTelechargementURL     *string   `json:"zoneTelechargementUrl"`
+	ZoneTelechargementMirrors *[]string `json:"zoneTelechargementMirrors"`
+	// How the site is scraped: User-Agent, proxy URL ("" for none), minimum milliseconds between
+	// requests to a host, seconds search and release pages stay cached (0 = no cache), and
+	// whether the cache is kept in the database
+	ZoneTelechargementUserAgent       *string `json:"zoneTelechargementUserAgent"`
+	ZoneTelechargementProxy           *string `json:"zoneTelechargementProxy"`
+	ZoneTelechargementRequestInterval *int    `json:"zoneTelechargementRequestInterval"`
+	ZoneTelechargementSearchCacheTTL  *int    `json:"zoneTelechargementSearchCacheTtl"`
+	ZoneTelechargementReleaseCacheTTL *int    `json:"zoneTelechargementReleaseCacheTtl"`
+	ZoneTelechargementCachePersist    *bool   `json:"zoneTelechargementCachePersist"`
+	Paths                             []struct {
 		Name string `json:"name"`
 		Path string `json:"path"`
 	} `json:"paths"`
@@ -69,6 +129,79 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if n := req.MaxConcurrentDownloads; n != nil && (*n < 1 || *n > downloader.MaxConcurrency) {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("maxConcurrentDownloads must be between 1 and %d", downloader.MaxConcurrency))
+		return
+	}
+	if n := req.MaxSegments; n != nil && (*n < 1 || *n > downloader.MaxSegments) {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("maxSegments must be between 1 and %d", downloader.MaxSegments))
+		return
+	}
+	if req.BandwidthLimit != nil && *req.BandwidthLimit < 0 {
+		RespondError(w, http.StatusBadRequest, "bandwidthLimit must not be negative")
+		return
+	}
+	if req.MaxAttempts != nil && *req.MaxAttempts < 1 {
+		RespondError(w, http.StatusBadRequest, "maxAttempts must be at least 1")
+		return
+	}
+	if req.RetryBaseDelay != nil && *req.RetryBaseDelay < 0 {
+		RespondError(w, http.StatusBadRequest, "retryBaseDelay must not be negative")
+		return
+	}
+	var hours downloader.ActiveHours
+	if req.ActiveHoursStart != nil || req.ActiveHoursEnd != nil {
+		if req.ActiveHoursStart == nil || req.ActiveHoursEnd == nil {
+			RespondError(w, http.StatusBadRequest, "activeHoursStart and activeHoursEnd must be set together")
+			return
+		}
+		hours = downloader.ActiveHours{Start: *req.ActiveHoursStart, End: *req.ActiveHoursEnd}
+		if err := hours.Validate(); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid active hours: "+err.Error())
+			return
+		}
+	}
+	if req.ZoneTelechargementURL != nil {
+		if _, err := zonetelechargement.NormalizeBaseURL(*req.ZoneTelechargementURL); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid zoneTelechargementUrl: "+err.Error())
+			return
+		}
+	}
+	if req.ZoneTelechargementMirrors != nil {
+		for _, mirror := range *req.ZoneTelechargementMirrors {
+			if _, err := zonetelechargement.NormalizeBaseURL(mirror); err != nil {
+				RespondError(w, http.StatusBadRequest, "Invalid zoneTelechargementMirrors: "+err.Error())
+				return
+			}
+		}
+	}
+	if req.ZoneTelechargementUserAgent != nil && strings.TrimSpace(*req.ZoneTelechargementUserAgent) == "" {
+		RespondError(w, http.StatusBadRequest, "zoneTelechargementUserAgent must not be empty")
+		return
+	}
+	if req.ZoneTelechargementProxy != nil {
+		if _, err := zonetelechargement.ParseProxy(*req.ZoneTelechargementProxy); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid zoneTelechargementProxy: "+err.Error())
+			return
+		}
+	}
+	if req.ZoneTelechargementRequestInterval != nil && *req.ZoneTelechargementRequestInterval < 0 {
+		RespondError(w, http.StatusBadRequest, "zoneTelechargementRequestInterval must not be negative")
+		return
+	}
+	if (req.ZoneTelechargementSearchCacheTTL != nil && *req.ZoneTelechargementSearchCacheTTL < 0) ||
+		(req.ZoneTelechargementReleaseCacheTTL != nil && *req.ZoneTelechargementReleaseCacheTTL < 0) {
+		RespondError(w, http.StatusBadRequest, "Cache TTLs must not be negative")
+		return
+	}
+	if req.BandwidthSchedule != nil {
+		for _, rule := range *req.BandwidthSchedule {
+			if err := rule.Validate(); err != nil {
+				RespondError(w, http.StatusBadRequest, "Invalid bandwidthSchedule: "+err.Error())
+				return
+			}
+		}
+	}
 
 	ctx := r.Context()
 	tx, err := database.Pool.Begin(ctx)
@@ -89,6 +222,109 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, http.StatusInternalServerError, "Failed to update plexToken")
 		return
 	}
+	if req.MaxConcurrentDownloads != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingConcurrency, strconv.Itoa(*req.MaxConcurrentDownloads)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update maxConcurrentDownloads")
+			return
+		}
+	}
+	if req.MaxSegments != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingMaxSegments, strconv.Itoa(*req.MaxSegments)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update maxSegments")
+			return
+		}
+	}
+	if req.MaxAttempts != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingMaxAttempts, strconv.Itoa(*req.MaxAttempts)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update maxAttempts")
+			return
+		}
+	}
+	if req.RetryBaseDelay != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingRetryBaseDelay, strconv.Itoa(*req.RetryBaseDelay)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update retryBaseDelay")
+			return
+		}
+	}
+	if req.ActiveHoursStart != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingActiveHoursStart, hours.Start); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update activeHoursStart")
+			return
+		}
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingActiveHoursEnd, hours.End); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update activeHoursEnd")
+			return
+		}
+	}
+	if req.OnefichierCDN != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, onefichier.SettingCDN, strconv.FormatBool(*req.OnefichierCDN)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update onefichierCdn")
+			return
+		}
+	}
+	if req.ZoneTelechargementMirrors != nil {
+		mirrors, _ := json.Marshal(*req.ZoneTelechargementMirrors)
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingMirrors, string(mirrors)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementMirrors")
+			return
+		}
+	}
+	if req.ZoneTelechargementUserAgent != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingUserAgent, strings.TrimSpace(*req.ZoneTelechargementUserAgent)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementUserAgent")
+			return
+		}
+	}
+	if req.ZoneTelechargementProxy != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingProxy, *req.ZoneTelechargementProxy); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementProxy")
+			return
+		}
+	}
+	if req.ZoneTelechargementRequestInterval != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingRequestInterval, strconv.Itoa(*req.ZoneTelechargementRequestInterval)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementRequestInterval")
+			return
+		}
+	}
+	if req.ZoneTelechargementSearchCacheTTL != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingSearchCacheTTL, strconv.Itoa(*req.ZoneTelechargementSearchCacheTTL)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementSearchCacheTtl")
+			return
+		}
+	}
+	if req.ZoneTelechargementReleaseCacheTTL != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingReleaseCacheTTL, strconv.Itoa(*req.ZoneTelechargementReleaseCacheTTL)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementReleaseCacheTtl")
+			return
+		}
+	}
+	if req.ZoneTelechargementCachePersist != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, zonetelechargement.SettingCachePersist, strconv.FormatBool(*req.ZoneTelechargementCachePersist)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementCachePersist")
+			return
+		}
+	}
+	// The domain is stored through the scraper so the time it changed is recorded with it.
+	if req.ZoneTelechargementURL != nil {
+		if err := zonetelechargement.StoreBaseURL(ctx, tx, *req.ZoneTelechargementURL); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update zoneTelechargementUrl")
+			return
+		}
+	}
+	if req.BandwidthLimit != nil {
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingBandwidthLimit, strconv.FormatInt(*req.BandwidthLimit, 10)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update bandwidthLimit")
+			return
+		}
+	}
+	if req.BandwidthSchedule != nil {
+		schedule, _ := json.Marshal(*req.BandwidthSchedule)
+		if _, err := tx.Exec(ctx, upsertQuery, downloader.SettingBandwidthSchedule, string(schedule)); err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to update bandwidthSchedule")
+			return
+		}
+	}
 
 	// Update Paths: Full replace strategy (Delete all, insert new)
 	if _, err := tx.Exec(ctx, "DELETE FROM paths"); err != nil {
@@ -108,5 +344,34 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Apply runtime settings to the running engine
+	if req.MaxConcurrentDownloads != nil {
+		downloader.SetConcurrency(*req.MaxConcurrentDownloads)
+	}
+	if req.ActiveHoursStart != nil {
+		downloader.SetActiveHours(hours)
+	}
+	if req.BandwidthLimit != nil || req.BandwidthSchedule != nil {
+		if err := applyBandwidth(ctx); err != nil {
+			log.Printf("Failed to apply bandwidth settings: %v", err)
+		}
+	}
+
 	RespondJSON(w, http.StatusOK, map[string]bool{"success": true})
 }
+
+// applyBandwidth reloads the stored bandwidth settings into the running engine, so a request
+// that changes only one of them keeps the other.
+func applyBandwidth(ctx context.Context) error {
+	settings, err := database.GetSettings(ctx, downloader.SettingBandwidthLimit, downloader.SettingBandwidthSchedule)
+	if err != nil {
+		return err
+	}
+	var schedule downloader.BandwidthSchedule
+	schedule.Limit, _ = strconv.ParseInt(settings[downloader.SettingBandwidthLimit], 10, 64)
+	if schedule.Rules, err = downloader.ParseBandwidthRules(settings[downloader.SettingBandwidthSchedule]); err != nil {
+		return err
+	}
+	downloader.SetBandwidth(schedule)
+	return nil
+}
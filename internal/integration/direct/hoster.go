@@ -0,0 +1,86 @@
+// Package direct is the fallback hoster for plain HTTP and HTTPS links, fetched as they are
+// with the download's own headers, cookies and basic-auth credentials.
+package direct
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+func init() {
+	integration.RegisterFallback(hoster{client: &http.Client{Timeout: 10 * time.Second, CheckRedirect: integration.CheckRedirect}})
+}
+
+type hoster struct {
+	client *http.Client
+}
+
+func (hoster) Name() string { return "HTTP" }
+
+func (hoster) Match(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (hoster) Resolve(ctx context.Context, rawURL string, opts integration.Options) (*integration.DirectLink, error) {
+	return &integration.DirectLink{URL: rawURL, Header: opts.Header}, nil
+}
+
+// Info asks the server for the file's headers with a HEAD request.
+func (h hoster) Info(ctx context.Context, rawURL string, opts integration.Options) (*integration.FileInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range opts.Header {
+		req.Header[name] = values
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("network error: %w", err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, fmt.Errorf("server returned %s: %w", resp.Status, integration.ErrNotFound)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("server returned %s: %w", resp.Status, integration.ErrUnauthorized)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("server returned %s: %w", resp.Status, integration.ErrRateLimited)
+	case resp.StatusCode >= 400:
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	info := &integration.FileInfo{ContentType: resp.Header.Get("Content-Type"), Filename: filename(resp)}
+	if resp.ContentLength > 0 {
+		info.Size = resp.ContentLength
+	}
+	return info, nil
+}
+
+// Check has nothing to verify: plain links need no account.
+func (hoster) Check(ctx context.Context) (string, error) {
+	return "Ready", nil
+}
+
+// filename is the name given by Content-Disposition, else the last segment of the final URL.
+func filename(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return params["filename"]
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "/" && name != "." && !strings.HasSuffix(resp.Request.URL.Path, "/") {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,256 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"github.com/gautch29/downloader-backend/internal/model"
+)
+
+// serveFTP runs a minimal FTP server on root, enough for the client: login as me/secret,
+// extended passive mode, SIZE, REST, RETR, CWD and LIST. It returns the server's address.
+func serveFTP(t *testing.T, root string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, root)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveConn(conn net.Conn, root string) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) { tp.PrintfLine("%d %s", code, msg) }
+	local := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+
+	var user string
+	var rest int64
+	var data net.Listener
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	// transfer sends what write produces over the data connection opened by EPSV.
+	transfer := func(write func(io.Writer) error) {
+		if data == nil {
+			reply(425, "Use EPSV first")
+			return
+		}
+		dc, err := data.Accept()
+		data.Close()
+		data = nil
+		if err != nil {
+			reply(425, "No data connection")
+			return
+		}
+		reply(150, "Sending")
+		err = write(dc)
+		dc.Close()
+		if err != nil {
+			reply(451, err.Error())
+			return
+		}
+		reply(226, "Done")
+	}
+
+	reply(220, "ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			user = arg
+			reply(331, "Password required")
+		case "PASS":
+			if user == "me" && arg == "secret" {
+				reply(230, "Logged in")
+			} else {
+				reply(530, "Login incorrect")
+			}
+		case "TYPE":
+			reply(200, "OK")
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port))
+		case "SIZE":
+			if info, err := os.Stat(local(arg)); err == nil && info.Mode().IsRegular() {
+				reply(213, strconv.FormatInt(info.Size(), 10))
+			} else {
+				reply(550, "No such file")
+			}
+		case "REST":
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			reply(350, "Restarting")
+		case "RETR":
+			f, err := os.Open(local(arg))
+			if err != nil {
+				reply(550, "No such file")
+				continue
+			}
+			f.Seek(rest, io.SeekStart)
+			rest = 0
+			transfer(func(w io.Writer) error {
+				_, err := io.Copy(w, f)
+				return err
+			})
+			f.Close()
+		case "CWD":
+			if info, err := os.Stat(local(arg)); err == nil && info.IsDir() {
+				reply(250, "OK")
+			} else {
+				reply(550, "Not a directory")
+			}
+		case "LIST":
+			entries, err := os.ReadDir(local(arg))
+			if err != nil {
+				reply(550, "No such directory")
+				continue
+			}
+			transfer(func(w io.Writer) error {
+				for _, e := range entries {
+					info, _ := e.Info()
+					mode := "-rw-r--r--"
+					if e.IsDir() {
+						mode = "drwxr-xr-x"
+					}
+					fmt.Fprintf(w, "%s 1 me me %d Jan 01 00:00 %s\r\n", mode, info.Size(), e.Name())
+				}
+				return nil
+			})
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Not implemented")
+		}
+	}
+}
+
+func setup(t *testing.T) (root, base string) {
+	t.Helper()
+	saved := findCredential
+	findCredential = func(context.Context, string, string, string) (*model.Credential, error) { return nil, nil }
+	t.Cleanup(func() { findCredential = saved })
+	root = t.TempDir()
+	return root, "ftp://me:secret@" + serveFTP(t, root)
+}
+
+func TestOpenResumes(t *testing.T) {
+	root, base := setup(t)
+	data := []byte(strings.Repeat("0123456789", 1000))
+	os.WriteFile(filepath.Join(root, "movie.mkv"), data, 0o644)
+
+	stream, err := hoster{}.Open(context.Background(), base+"/movie.mkv", 2500, integration.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	got, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.Offset != 2500 || stream.Size != int64(len(data)) || stream.Filename != "movie.mkv" {
+		t.Errorf("stream = offset %d, size %d, name %q", stream.Offset, stream.Size, stream.Filename)
+	}
+	if string(got) != string(data[2500:]) {
+		t.Errorf("read %d bytes, want the %d after the offset", len(got), len(data)-2500)
+	}
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	_, base := setup(t)
+	_, err := hoster{}.Open(context.Background(), base+"/missing.mkv", 0, integration.Options{})
+	if !errors.Is(err, integration.ErrNotFound) {
+		t.Errorf("error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	root, base := setup(t)
+	os.MkdirAll(filepath.Join(root, "show", "Season 01"), 0o755)
+	os.WriteFile(filepath.Join(root, "show", "info.nfo"), []byte("nfo"), 0o644)
+	os.WriteFile(filepath.Join(root, "show", "Season 01", "e01.mkv"), []byte("episode"), 0o644)
+
+	// The login is given apart from the link, as for a queued download, and is not copied into
+	// the links of the files.
+	link, login := integration.SplitLogin(base + "/show")
+	entries, err := hoster{}.Expand(context.Background(), link, integration.Options{Login: login})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	want := []integration.Entry{
+		{URL: link + "/Season%2001/e01.mkv", Filename: "e01.mkv", Size: 7, Dir: "Season 01"},
+		{URL: link + "/info.nfo", Filename: "info.nfo", Size: 3},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v\nwant %+v", entries, want)
+	}
+
+	// A file link is not expanded.
+	entries, err = hoster{}.Expand(context.Background(), base+"/show/info.nfo", integration.Options{})
+	if err != nil || entries != nil {
+		t.Errorf("file link expanded to %v, %v", entries, err)
+	}
+}
+
+func TestBadLogin(t *testing.T) {
+	_, base := setup(t)
+	base = strings.Replace(base, "me:secret", "me:wrong", 1)
+	_, err := hoster{}.Info(context.Background(), base+"/movie.mkv", integration.Options{})
+	if !errors.Is(err, integration.ErrUnauthorized) {
+		t.Errorf("error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestCheckLogsInToSavedHosts(t *testing.T) {
+	_, base := setup(t)
+	addr := strings.TrimPrefix(base, "ftp://me:secret@")
+	password := "secret"
+	savedFind, savedHosts := findCredential, credentialHosts
+	findCredential = func(ctx context.Context, protocol, host, hostname string) (*model.Credential, error) {
+		return &model.Credential{Protocol: protocol, Host: host, Username: "me", Password: password}, nil
+	}
+	hosts := []string{addr}
+	credentialHosts = func(context.Context, string) ([]string, error) { return hosts, nil }
+	t.Cleanup(func() { findCredential, credentialHosts = savedFind, savedHosts })
+
+	if _, err := (hoster{}).Check(context.Background()); err != nil {
+		t.Errorf("error = %v with the right login", err)
+	}
+	password = "wrong"
+	if _, err := (hoster{}).Check(context.Background()); !errors.Is(err, integration.ErrUnauthorized) {
+		t.Errorf("error = %v, want ErrUnauthorized", err)
+	}
+	hosts = nil
+	if _, err := (hoster{}).Check(context.Background()); !errors.Is(err, integration.ErrNotChecked) {
+		t.Errorf("error = %v without saved credentials, want ErrNotChecked", err)
+	}
+}
@@ -2,53 +2,370 @@ package onefichier
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
 const BaseURL = "https://api.1fichier.com/v1"
 
 type Client struct {
-	APIKey string
+	APIKey  string
+	BaseURL string
+	HTTP    *http.Client
 }
 
 func NewClient(apiKey string) *Client {
-	return &Client{APIKey: apiKey}
+	return &Client{
+		APIKey:  apiKey,
+		BaseURL: BaseURL,
+		HTTP:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// apiStatus is the envelope shared by every 1fichier API response.
+type apiStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
 }
 
-// CheckAPI verifies if the API key is valid by making a dummy request (e.g., getting user info or usage)
-// Since 1fichier API documentation might vary, we'll try a generic endpoint or just check if we can make a request.
-// For now, checks "account/info" if available, or just considers it reachable if no network error.
-// To be safe and minimal: checking "folder/ls" on root or similar.
-// A better simple check is usually account info.
-func (c *Client) CheckAPI() error {
+// call POSTs payload as JSON to an API endpoint and decodes the response into out (which may be nil).
+func (c *Client) call(ctx context.Context, endpoint string, payload, out interface{}) error {
 	if c.APIKey == "" {
-		return fmt.Errorf("API key is missing")
+		return fmt.Errorf("API key is missing: %w", ErrInvalidKey)
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
 	}
 
-	// Payload for many 1fichier requests
-	payload := map[string]interface{}{}
-	jsonPayload, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", BaseURL+"/user/info.cgi", bytes.NewBuffer(jsonPayload))
+	if err := limiter.wait(ctx, endpoint); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+endpoint, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.APIKey)
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return fmt.Errorf("network error: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("API returned error: %s", resp.Status)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("network error: %w", err)
 	}
 
+	// Errors come back as {"status":"KO","message":"..."}, with or without an HTTP error code.
+	var status apiStatus
+	json.Unmarshal(body, &status)
+	if resp.StatusCode >= 400 || status.Status == "KO" {
+		return failure(resp.StatusCode, status.Message)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("unexpected API response: %w", err)
+		}
+	}
 	return nil
 }
+
+// failure builds the error for an error reply, pausing further calls when it is a flood warning.
+func failure(statusCode int, message string) *APIError {
+	err := newAPIError(statusCode, message)
+	if err.Err == ErrFlood {
+		limiter.flood()
+	}
+	return err
+}
+
+// AccountInfo is the state of the 1fichier account the API key belongs to.
+type AccountInfo struct {
+	Email   string `json:"email"`
+	Premium bool   `json:"premium"`
+	// ExpiresAt is the end of the premium subscription, nil when unknown or not premium.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// ColdTraffic and HotTraffic are the bytes left for regular and CDN downloads, nil when
+	// the account reports no limit.
+	ColdTraffic *int64 `json:"coldTraffic,omitempty"`
+	HotTraffic  *int64 `json:"hotTraffic,omitempty"`
+}
+
+type userInfoResponse struct {
+	Email           string `json:"email"`
+	Offer           int    `json:"offer"` // 0 free, 1 premium, 2 premium access
+	SubscriptionEnd string `json:"subscription_end"`
+	ColdTraffic     *int64 `json:"cold_traffic"`
+	HotTraffic      *int64 `json:"hot_traffic"`
+}
+
+// AccountInfo returns the subscription and remaining traffic of the account. It also serves to
+// verify that the API key is valid.
+func (c *Client) AccountInfo(ctx context.Context) (*AccountInfo, error) {
+	var resp userInfoResponse
+	if err := c.call(ctx, "/user/info.cgi", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	info := &AccountInfo{
+		Email:       resp.Email,
+		Premium:     resp.Offer > 0,
+		ColdTraffic: resp.ColdTraffic,
+		HotTraffic:  resp.HotTraffic,
+	}
+	if t, ok := parseDate(resp.SubscriptionEnd); ok {
+		info.ExpiresAt = &t
+	}
+	return info, nil
+}
+
+// parseDate parses the dates returned by the API, which are in French local time.
+func parseDate(value string) (time.Time, bool) {
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		loc = time.UTC
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hosts are the domains serving 1fichier files.
+var hosts = []string{
+	"1fichier.com", "alterupload.com", "cjoint.net", "desfichiers.com", "dfichiers.com",
+	"megadl.fr", "mesfichiers.org", "piecejointe.net", "pjointe.com", "tenvoi.com", "dl4free.com",
+}
+
+// IsLink reports whether rawURL points at a file hosted on 1fichier or one of its alias domains.
+func IsLink(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFolder reports whether rawURL is a shared 1fichier folder (https://1fichier.com/dir/...).
+func IsFolder(rawURL string) bool {
+	if !IsLink(rawURL) {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasPrefix(u.Path, "/dir/")
+}
+
+// FolderFile is a file listed in a shared folder.
+type FolderFile struct {
+	URL      string `json:"link"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// ListFolder returns the files of a shared folder. Shared folders are not part of the API:
+// the folder page itself answers in JSON when asked with ?json=1. A password-protected folder
+// is unlocked by posting its password. A missing folder yields ErrFileNotFound.
+func (c *Client) ListFolder(ctx context.Context, folderURL, password string) ([]FolderFile, error) {
+	u, err := url.Parse(folderURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("json", "1")
+	u.RawQuery = q.Encode()
+
+	var req *http.Request
+	if password != "" {
+		form := url.Values{"pass": {password}}
+		req, err = http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := limiter.wait(ctx, "/dir"); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("network error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("network error: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		var status apiStatus
+		json.Unmarshal(body, &status)
+		return nil, failure(resp.StatusCode, status.Message)
+	}
+
+	var files []FolderFile
+	if err := json.Unmarshal(body, &files); err != nil {
+		// Errors, such as a wrong password, come back as a status object instead of a list.
+		var status apiStatus
+		if json.Unmarshal(body, &status) == nil && status.Status == "KO" {
+			return nil, failure(resp.StatusCode, status.Message)
+		}
+		return nil, fmt.Errorf("unexpected folder listing: %w", err)
+	}
+	return files, nil
+}
+
+// DownloadOptions tune how a direct download link is generated.
+type DownloadOptions struct {
+	// Password unlocks a password-protected file.
+	Password string
+	// CDN serves the file from 1fichier's CDN, which consumes the account's CDN credit.
+	CDN bool
+}
+
+type getTokenRequest struct {
+	URL  string `json:"url"`
+	Pass string `json:"pass,omitempty"`
+	CDN  int    `json:"cdn"`
+}
+
+type getTokenResponse struct {
+	URL string `json:"url"`
+}
+
+// GetDownloadLink resolves a 1fichier file URL into a one-time direct download URL.
+func (c *Client) GetDownloadLink(ctx context.Context, fileURL string, opts DownloadOptions) (string, error) {
+	req := getTokenRequest{URL: fileURL, Pass: opts.Password}
+	if opts.CDN {
+		req.CDN = 1
+	}
+
+	var resp getTokenResponse
+	if err := c.call(ctx, "/download/get_token.cgi", req, &resp); err != nil {
+		return "", err
+	}
+	if resp.URL == "" {
+		return "", fmt.Errorf("API returned no download URL")
+	}
+	return resp.URL, nil
+}
+
+// FileInfo is the metadata 1fichier holds about a file.
+type FileInfo struct {
+	URL         string `json:"url"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	Date        string `json:"date"`
+	Checksum    string `json:"checksum"` // Whirlpool, hex-encoded
+	ContentType string `json:"content-type"`
+	Description string `json:"description"`
+	Password    int    `json:"pass"` // 1 when the file is password-protected
+}
+
+type fileInfoRequest struct {
+	URL  string `json:"url"`
+	Pass string `json:"pass,omitempty"`
+}
+
+// FileInfo returns the metadata of a 1fichier file. A file that does not exist anymore yields
+// ErrFileNotFound.
+func (c *Client) FileInfo(ctx context.Context, fileURL, password string) (*FileInfo, error) {
+	var info FileInfo
+	if err := c.call(ctx, "/file/info.cgi", fileInfoRequest{URL: fileURL, Pass: password}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+type remoteRequest struct {
+	URLs     []string `json:"urls"`
+	FolderID int      `json:"folder_id"`
+}
+
+type remoteResponse struct {
+	ID int `json:"id"`
+}
+
+// RemoteUpload asks 1fichier to fetch the given URLs into a folder of the account (0 is the
+// root folder). It returns the id of the remote upload request; 1fichier fetches the files
+// in the background.
+func (c *Client) RemoteUpload(ctx context.Context, urls []string, folderID int) (int, error) {
+	var resp remoteResponse
+	if err := c.call(ctx, "/remote/request.cgi", remoteRequest{URLs: urls, FolderID: folderID}, &resp); err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+// Folder is a folder of the account with its direct contents.
+type Folder struct {
+	ID      int         `json:"id"`
+	Name    string      `json:"name"`
+	Folders []SubFolder `json:"folders"`
+	Files   []FileInfo  `json:"files"`
+}
+
+// SubFolder is a folder listed inside another one.
+type SubFolder struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+type folderLsRequest struct {
+	FolderID int `json:"folder_id"`
+	Files    int `json:"files"`
+}
+
+type folderLsResponse struct {
+	FolderID   int    `json:"folder_id"`
+	Name       string `json:"name"`
+	SubFolders []struct {
+		ID         int    `json:"id"`
+		Name       string `json:"name"`
+		CreateDate string `json:"create_date"`
+	} `json:"sub_folders"`
+	Items []FileInfo `json:"items"`
+}
+
+// ListAccountFolder returns the sub-folders and files of a folder of the account (0 is the root folder).
+func (c *Client) ListAccountFolder(ctx context.Context, folderID int) (*Folder, error) {
+	var resp folderLsResponse
+	if err := c.call(ctx, "/folder/ls.cgi", folderLsRequest{FolderID: folderID, Files: 1}, &resp); err != nil {
+		return nil, err
+	}
+
+	folder := &Folder{ID: folderID, Name: resp.Name, Folders: []SubFolder{}, Files: resp.Items}
+	for _, sub := range resp.SubFolders {
+		folder.Folders = append(folder.Folders, SubFolder{ID: sub.ID, Name: sub.Name, CreatedAt: sub.CreateDate})
+	}
+	if folder.Files == nil {
+		folder.Files = []FileInfo{}
+	}
+	return folder, nil
+}
@@ -0,0 +1,121 @@
+package onefichier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves /download/get_token.cgi, recording each request body and answering with reply.
+func fakeAPI(t *testing.T, status int, reply string) (*Client, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/download/get_token.cgi" {
+			t.Errorf("unexpected call to %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		requests = append(requests, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(srv.Close)
+
+	// Calls are not spaced out against the fake.
+	saved := limiter
+	limiter = &rateLimiter{nextByPath: make(map[string]time.Time)}
+	t.Cleanup(func() { limiter = saved })
+
+	c := NewClient("key")
+	c.BaseURL = srv.URL
+	return c, &requests
+}
+
+func TestGetDownloadLink(t *testing.T) {
+	const fileURL = "https://1fichier.com/?abcdef"
+	tests := []struct {
+		name  string
+		opts  DownloadOptions
+		want  map[string]any
+		reply string
+	}{
+		{
+			name:  "file",
+			want:  map[string]any{"url": fileURL, "cdn": float64(0)},
+			reply: `{"status":"OK","url":"https://a-1.1fichier.com/c123"}`,
+		},
+		{
+			name:  "password",
+			opts:  DownloadOptions{Password: "secret"},
+			want:  map[string]any{"url": fileURL, "pass": "secret", "cdn": float64(0)},
+			reply: `{"status":"OK","url":"https://a-1.1fichier.com/c123"}`,
+		},
+		{
+			name:  "cdn",
+			opts:  DownloadOptions{CDN: true},
+			want:  map[string]any{"url": fileURL, "cdn": float64(1)},
+			reply: `{"status":"OK","url":"https://a-1.1fichier.com/c123"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, requests := fakeAPI(t, http.StatusOK, tt.reply)
+			link, err := c.GetDownloadLink(context.Background(), fileURL, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link != "https://a-1.1fichier.com/c123" {
+				t.Errorf("link = %q", link)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("%d requests, want 1", len(*requests))
+			}
+			got := (*requests)[0]
+			if len(got) != len(tt.want) {
+				t.Errorf("request = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("request[%q] = %v, want %v", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDownloadLinkErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		reply  string
+		want   error
+	}{
+		{"password", http.StatusOK, `{"status":"KO","message":"Password required or invalid #210"}`, ErrPasswordRequired},
+		{"not found", http.StatusOK, `{"status":"KO","message":"Resource not found #469"}`, ErrFileNotFound},
+		{"not found status", http.StatusNotFound, `{"status":"KO","message":"Unknown file"}`, ErrFileNotFound},
+		{"empty url", http.StatusOK, `{"status":"OK","url":""}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := fakeAPI(t, tt.status, tt.reply)
+			link, err := c.GetDownloadLink(context.Background(), "https://1fichier.com/?abcdef", DownloadOptions{})
+			if err == nil {
+				t.Fatalf("got link %q, want an error", link)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
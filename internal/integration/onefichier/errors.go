@@ -0,0 +1,108 @@
+package onefichier
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+// Errors reported by the 1fichier API. An *APIError unwraps to one of them when its status or
+// message is recognized, so callers can test with errors.Is. Each one also wraps the matching
+// integration error.
+var (
+	// ErrFlood means the API refused the call because of too many requests; calls are paused for a while.
+	ErrFlood = fmt.Errorf("1fichier: too many requests (flood protection): %w", integration.ErrRateLimited)
+	// ErrInvalidKey means the API key is missing, wrong or revoked.
+	ErrInvalidKey = fmt.Errorf("1fichier: invalid API key: %w", integration.ErrUnauthorized)
+	// ErrFileNotFound means the file or folder does not exist (anymore).
+	ErrFileNotFound = fmt.Errorf("1fichier: %w", integration.ErrNotFound)
+	// ErrPasswordRequired means the file or folder is password-protected and the password is missing or wrong.
+	ErrPasswordRequired = fmt.Errorf("1fichier: %w", integration.ErrPasswordRequired)
+	// ErrWait means 1fichier asks to wait before downloading again, e.g. between two free downloads.
+	ErrWait = fmt.Errorf("1fichier: %w", integration.ErrWaitRequired)
+)
+
+// APIError is a request the 1fichier API answered with an error status or a "KO" payload.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Err is the recognized error kind, nil when the message is not one we know.
+	Err error
+	// Wait is the delay asked for by an ErrWait message.
+	Wait time.Duration
+}
+
+func newAPIError(statusCode int, message string) *APIError {
+	e := &APIError{StatusCode: statusCode, Message: message, Err: matchError(statusCode, message)}
+	if wait, ok := parseWait(message); ok && e.Err == nil {
+		e.Err, e.Wait = ErrWait, wait
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API returned error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return "API returned error: " + e.Message
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// RetryAfter is how long to wait before calling again after a flood warning or a wait message.
+func (e *APIError) RetryAfter() time.Duration {
+	switch e.Err {
+	case ErrFlood:
+		return FloodPause
+	case ErrWait:
+		return e.Wait
+	}
+	return 0
+}
+
+// waitPattern finds the delay in messages such as "You must wait 5 minutes between each
+// download" or "Vous devez attendre 30 secondes".
+var waitPattern = regexp.MustCompile(`(?i)(?:wait|attendre)\s+(?:for\s+)?(\d+)\s*(seconds?|secondes?|secs?|s|minutes?|mins?|m|hours?|heures?|h)\b`)
+
+// parseWait returns the delay asked for by a wait message.
+func parseWait(message string) (time.Duration, bool) {
+	m := waitPattern.FindStringSubmatch(message)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	unit := time.Minute
+	switch strings.ToLower(m[2])[0] {
+	case 's':
+		unit = time.Second
+	case 'h':
+		unit = time.Hour
+	}
+	return time.Duration(n) * unit, true
+}
+
+// matchError recognizes an error from its HTTP status and the message of the JSON payload,
+// e.g. {"status":"KO","message":"Flood detected: IP Locked #38"}.
+func matchError(statusCode int, message string) error {
+	message = strings.ToLower(message)
+	switch {
+	case statusCode == http.StatusTooManyRequests || strings.Contains(message, "flood"):
+		return ErrFlood
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden || strings.Contains(message, "not authenticated") ||
+		strings.Contains(message, "bad key") || strings.Contains(message, "invalid key") || strings.Contains(message, "api key"):
+		return ErrInvalidKey
+	case strings.Contains(message, "password"):
+		return ErrPasswordRequired
+	case statusCode == http.StatusNotFound || strings.Contains(message, "not found"):
+		return ErrFileNotFound
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package onefichier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+func TestWaitMessages(t *testing.T) {
+	tests := []struct {
+		message string
+		wait    time.Duration
+	}{
+		{"You must wait 5 minutes between each download", 5 * time.Minute},
+		{"Please wait for 30 seconds", 30 * time.Second},
+		{"Vous devez attendre 2 heures", 2 * time.Hour},
+		{"Wait 10 min", 10 * time.Minute},
+		{"Resource not found", 0},
+	}
+	for _, tt := range tests {
+		err := newAPIError(200, tt.message)
+		if got := integration.RetryAfter(err); got != tt.wait {
+			t.Errorf("%q: RetryAfter = %s, want %s", tt.message, got, tt.wait)
+		}
+		if isWait := errors.Is(err, integration.ErrWaitRequired); isWait != (tt.wait > 0) {
+			t.Errorf("%q: errors.Is(ErrWaitRequired) = %v", tt.message, isWait)
+		}
+	}
+}
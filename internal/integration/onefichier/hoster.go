@@ -0,0 +1,101 @@
+package onefichier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+// SettingCDN is the settings key enabling 1fichier's CDN ("true"/"false") for generated links.
+const SettingCDN = "onefichierCdn"
+
+func init() {
+	integration.Register(hoster{})
+}
+
+// hoster plugs 1fichier into the integration registry, using the account of ONEFICHIER_API_KEY.
+type hoster struct{}
+
+func (hoster) Name() string { return "1fichier" }
+
+func (hoster) Match(rawURL string) bool { return IsLink(rawURL) }
+
+func (hoster) client() *Client { return NewClient(os.Getenv("ONEFICHIER_API_KEY")) }
+
+// Resolve exchanges a file link for a one-time direct download link, served from the CDN when
+// the setting asks for it.
+func (h hoster) Resolve(ctx context.Context, rawURL string, opts integration.Options) (*integration.DirectLink, error) {
+	dlOpts := DownloadOptions{Password: opts.Password}
+	if settings, err := database.GetSettings(ctx, SettingCDN); err == nil {
+		dlOpts.CDN = settings[SettingCDN] == "true"
+	}
+	link, err := h.client().GetDownloadLink(ctx, rawURL, dlOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &integration.DirectLink{URL: link}, nil
+}
+
+func (h hoster) Info(ctx context.Context, rawURL string, opts integration.Options) (*integration.FileInfo, error) {
+	info, err := h.client().FileInfo(ctx, rawURL, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	result := &integration.FileInfo{
+		Filename:          info.Filename,
+		Size:              info.Size,
+		ContentType:       info.ContentType,
+		PasswordProtected: info.Password == 1,
+	}
+	if checksum := strings.TrimSpace(info.Checksum); checksum != "" {
+		result.Checksum = "whirlpool:" + strings.ToLower(checksum)
+	}
+	return result, nil
+}
+
+// Expand lists the files of a shared folder; an empty folder yields an empty, non-nil list.
+func (h hoster) Expand(ctx context.Context, rawURL string, opts integration.Options) ([]integration.Entry, error) {
+	if !IsFolder(rawURL) {
+		return nil, nil
+	}
+	files, err := h.client().ListFolder(ctx, rawURL, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]integration.Entry, len(files))
+	for i, f := range files {
+		entries[i] = integration.Entry{URL: f.URL, Filename: f.Filename, Size: f.Size}
+	}
+	return entries, nil
+}
+
+// Check validates the API key and summarizes the account.
+func (h hoster) Check(ctx context.Context) (string, error) {
+	account, err := h.client().AccountInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	return account.Summary(), nil
+}
+
+// Summary describes the account, e.g. "Premium until 2025-03-01, cold traffic left: 512.00 GB".
+func (a *AccountInfo) Summary() string {
+	parts := []string{"Free account"}
+	if a.Premium {
+		parts[0] = "Premium"
+		if a.ExpiresAt != nil {
+			parts[0] += " until " + a.ExpiresAt.Format("2006-01-02")
+		}
+	}
+	if a.ColdTraffic != nil {
+		parts = append(parts, fmt.Sprintf("cold traffic left: %.2f GB", float64(*a.ColdTraffic)/1024/1024/1024))
+	}
+	if a.HotTraffic != nil {
+		parts = append(parts, fmt.Sprintf("hot traffic left: %.2f GB", float64(*a.HotTraffic)/1024/1024/1024))
+	}
+	return strings.Join(parts, ", ")
+}
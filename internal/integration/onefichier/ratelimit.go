@@ -0,0 +1,79 @@
+package onefichier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minInterval is the minimum delay between any two calls to 1fichier.
+const minInterval = 500 * time.Millisecond
+
+// endpointIntervals are the stricter minimum delays between calls to the same endpoint.
+var endpointIntervals = map[string]time.Duration{
+	"/download/get_token.cgi": 2 * time.Second,
+	"/file/info.cgi":          time.Second,
+	"/user/info.cgi":          5 * time.Second,
+	"/remote/request.cgi":     5 * time.Second,
+	"/folder/ls.cgi":          time.Second,
+}
+
+// FloodPause is how long every call is refused after 1fichier reported a flood.
+const FloodPause = 5 * time.Minute
+
+// rateLimiter spaces out calls to 1fichier. It is shared by every Client, since the limits
+// apply to the account and the IP address rather than to one client.
+type rateLimiter struct {
+	mu         sync.Mutex
+	next       time.Time            // earliest time for any call
+	nextByPath map[string]time.Time // earliest time per endpoint
+	floodUntil time.Time
+}
+
+var limiter = &rateLimiter{nextByPath: make(map[string]time.Time)}
+
+// wait blocks until a call to endpoint is allowed and reserves it. While a flood pause is in
+// effect it fails immediately with an error wrapping ErrFlood.
+func (l *rateLimiter) wait(ctx context.Context, endpoint string) error {
+	l.mu.Lock()
+	now := time.Now()
+	if now.Before(l.floodUntil) {
+		until := l.floodUntil
+		l.mu.Unlock()
+		return &APIError{
+			Message: fmt.Sprintf("calls paused until %s after a flood warning", until.Format(time.TimeOnly)),
+			Err:     ErrFlood,
+		}
+	}
+	at := now
+	if l.next.After(at) {
+		at = l.next
+	}
+	if next := l.nextByPath[endpoint]; next.After(at) {
+		at = next
+	}
+	l.next = at.Add(minInterval)
+	if d, ok := endpointIntervals[endpoint]; ok {
+		l.nextByPath[endpoint] = at.Add(d)
+	}
+	l.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// flood pauses every call for FloodPause.
+func (l *rateLimiter) flood() {
+	l.mu.Lock()
+	l.floodUntil = time.Now().Add(FloodPause)
+	l.mu.Unlock()
+}
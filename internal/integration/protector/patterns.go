@@ -0,0 +1,17 @@
+package protector
+
+import "regexp"
+
+// defaultPatterns are the protectors known out of the box.
+func defaultPatterns() []Pattern {
+	return []Pattern{
+		{
+			// dl-protect and its successive domains (dl-protect.link, dl-protect.net, ...) show a
+			// "continue" form, sometimes with a captcha, then the link in a div of class "lienet".
+			Name:    "dl-protect",
+			URL:     regexp.MustCompile(`^https?://(?:www\.)?dl-protect\d*\.[a-z]+/`),
+			Link:    regexp.MustCompile(`(?is)class=["']lienet["'][^>]*>\s*<a[^>]*href=["']([^"']+)["']`),
+			Confirm: true,
+		},
+	}
+}
@@ -0,0 +1,267 @@
+// Package protector unwraps link-protector pages, such as dl-protect, that sites like
+// Zone-Telechargement put in front of hoster links. Unwrap runs before a link is handed to a
+// hoster: it follows the protector's redirects and reads its page until it finds a link a
+// hoster supports. Protectors are described by a pattern table that can be extended with
+// Register.
+package protector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+// ErrCaptchaRequired is returned, wrapped, when a protector page only reveals its link after a
+// captcha is solved, which has to be done in a browser.
+var ErrCaptchaRequired = errors.New("captcha required")
+
+// ErrNoLink is returned, wrapped, when a protector page holds no link a hoster supports.
+var ErrNoLink = errors.New("no hoster link found")
+
+// Pattern describes one link protector.
+type Pattern struct {
+	// Name identifies the protector in errors and logs.
+	Name string
+	// URL matches the protector's links.
+	URL *regexp.Regexp
+	// Link extracts the protected link from the page, as its first submatch. When nil, the
+	// first link on the page that a hoster supports is taken.
+	Link *regexp.Regexp
+	// Confirm is set for protectors that show the link only after their form is posted back,
+	// e.g. a "continue" button.
+	Confirm bool
+}
+
+// maxDepth bounds how many protectors may be nested in one another.
+const maxDepth = 3
+
+// maxPageSize bounds how much of a protector page is read.
+const maxPageSize = 2 << 20
+
+var (
+	mu       sync.RWMutex
+	patterns = defaultPatterns()
+)
+
+// Register adds a protector. It is tried before the ones already known.
+func Register(p Pattern) {
+	mu.Lock()
+	defer mu.Unlock()
+	patterns = append([]Pattern{p}, patterns...)
+}
+
+// lookup returns the protector of rawURL, or nil.
+func lookup(rawURL string) *Pattern {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := range patterns {
+		if patterns[i].URL.MatchString(rawURL) {
+			p := patterns[i]
+			return &p
+		}
+	}
+	return nil
+}
+
+// Match reports whether rawURL is a protected link.
+func Match(rawURL string) bool {
+	return lookup(rawURL) != nil
+}
+
+var client = &http.Client{Timeout: 20 * time.Second, CheckRedirect: checkRedirect}
+
+// checkRedirect applies the usual redirect policy, but stops at a redirect to a hoster link so
+// the hoster's page is never fetched here.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if err := integration.CheckRedirect(req, via); err != nil {
+		return err
+	}
+	if target := req.URL.String(); integration.Supports(target) && !Match(target) {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// Unwrap returns the hoster link behind a protected link, or rawURL itself when it is not
+// protected.
+func Unwrap(ctx context.Context, rawURL string) (string, error) {
+	link := rawURL
+	for depth := 0; depth < maxDepth; depth++ {
+		p := lookup(link)
+		if p == nil {
+			return link, nil
+		}
+		next, err := unwrap(ctx, p, link)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", p.Name, err)
+		}
+		link = next
+	}
+	if Match(link) {
+		return "", fmt.Errorf("more than %d nested link protectors: %w", maxDepth, ErrNoLink)
+	}
+	return link, nil
+}
+
+// unwrap opens a protector page and extracts the link it protects.
+func unwrap(ctx context.Context, p *Pattern, rawURL string) (string, error) {
+	page, err := fetch(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if page.redirect != "" {
+		return page.redirect, nil
+	}
+	if link := p.extract(page.body); link != "" {
+		return link, nil
+	}
+	if hasCaptcha(page.body) {
+		return "", ErrCaptchaRequired
+	}
+
+	if p.Confirm {
+		if action, values, ok := parseForm(page.body, page.url); ok {
+			page, err = fetch(ctx, http.MethodPost, action, values)
+			if err != nil {
+				return "", err
+			}
+			if page.redirect != "" {
+				return page.redirect, nil
+			}
+			if link := p.extract(page.body); link != "" {
+				return link, nil
+			}
+			if hasCaptcha(page.body) {
+				return "", ErrCaptchaRequired
+			}
+		}
+	}
+	return "", ErrNoLink
+}
+
+// page is a fetched protector page, or the link it redirected to.
+type page struct {
+	url      *url.URL
+	body     string
+	redirect string
+}
+
+func fetch(ctx context.Context, method, rawURL string, form url.Values) (*page, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("network error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		location, err := resp.Location()
+		if err != nil {
+			return nil, fmt.Errorf("redirect without a location: %s", resp.Status)
+		}
+		return &page{url: resp.Request.URL, redirect: location.String()}, nil
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, fmt.Errorf("protector returned %s: %w", resp.Status, integration.ErrNotFound)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("protector returned %s: %w", resp.Status, integration.ErrRateLimited)
+	case resp.StatusCode >= 400:
+		return nil, fmt.Errorf("protector returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("network error: %w", err)
+	}
+	return &page{url: resp.Request.URL, body: string(data)}, nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// extract finds the protected link in a page.
+func (p *Pattern) extract(body string) string {
+	if p.Link != nil {
+		if m := p.Link.FindStringSubmatch(body); len(m) > 1 {
+			return unescape(m[1])
+		}
+		return ""
+	}
+	for _, candidate := range linkPattern.FindAllString(body, -1) {
+		candidate = unescape(candidate)
+		if integration.Supports(candidate) && !Match(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// unescape decodes the HTML entities found in links, such as &amp;.
+func unescape(s string) string {
+	return strings.NewReplacer("&amp;", "&", "&#38;", "&", "&#x2F;", "/", "&#47;", "/").Replace(s)
+}
+
+// hasCaptcha spots captcha widgets (reCAPTCHA, hCaptcha, ...) and home-made captcha fields.
+func hasCaptcha(body string) bool {
+	lower := strings.ToLower(body)
+	return strings.Contains(lower, "captcha") || strings.Contains(lower, "cf-turnstile")
+}
+
+var (
+	formPattern   = regexp.MustCompile(`(?is)<form[^>]*method=["']?post["']?[^>]*>(.*?)</form>`)
+	actionPattern = regexp.MustCompile(`(?i)action=["']([^"']*)["']`)
+	inputPattern  = regexp.MustCompile(`(?i)<(?:input|button)[^>]*>`)
+	namePattern   = regexp.MustCompile(`(?i)\bname=["']([^"']*)["']`)
+	valuePattern  = regexp.MustCompile(`(?i)\bvalue=["']([^"']*)["']`)
+)
+
+// parseForm returns where the page's first POST form is sent and its named fields.
+func parseForm(body string, base *url.URL) (string, url.Values, bool) {
+	loc := formPattern.FindStringSubmatchIndex(body)
+	if loc == nil {
+		return "", nil, false
+	}
+	tag := body[loc[0]:loc[2]]
+	action := base.String()
+	if m := actionPattern.FindStringSubmatch(tag); m != nil && m[1] != "" {
+		ref, err := base.Parse(unescape(m[1]))
+		if err != nil {
+			return "", nil, false
+		}
+		action = ref.String()
+	}
+
+	values := url.Values{}
+	for _, input := range inputPattern.FindAllString(body[loc[2]:loc[3]], -1) {
+		name := namePattern.FindStringSubmatch(input)
+		if name == nil {
+			continue
+		}
+		var value string
+		if m := valuePattern.FindStringSubmatch(input); m != nil {
+			value = unescape(m[1])
+		}
+		values.Add(name[1], value)
+	}
+	return action, values, true
+}
@@ -0,0 +1,170 @@
+package protector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	_ "github.com/gautch29/downloader-backend/internal/integration/onefichier"
+)
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// serveProtector serves the fixtures as a protector under /p/ (dl-protect's pattern) and /plain/
+// (a pattern without a Link expression), registered for the duration of the test.
+func serveProtector(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/p/link":
+			w.Write([]byte(fixture(t, "link.html")))
+		case "/p/continue":
+			w.Write([]byte(fixture(t, "continue.html")))
+		case "/go":
+			r.ParseForm()
+			if r.Method != http.MethodPost || r.URL.Query().Get("step") != "2" || r.PostForm.Get("_token") != "f00dcafe" {
+				http.Error(w, "bad form", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(fixture(t, "link.html")))
+		case "/p/captcha":
+			w.Write([]byte(fixture(t, "captcha.html")))
+		case "/p/nested":
+			w.Write([]byte(strings.ReplaceAll(fixture(t, "nested.html"), "{{inner}}", srv.URL+"/p/continue")))
+		case "/p/loop":
+			w.Write([]byte(strings.ReplaceAll(fixture(t, "nested.html"), "{{inner}}", srv.URL+"/p/loop")))
+		case "/p/nolink":
+			w.Write([]byte(fixture(t, "nolink.html")))
+		case "/p/redirect":
+			http.Redirect(w, r, "https://1fichier.com/?redirected", http.StatusFound)
+		case "/plain/page":
+			w.Write([]byte(fixture(t, "plain.html")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	mu.Lock()
+	saved := patterns
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		patterns = saved
+		mu.Unlock()
+	})
+	dlProtect := defaultPatterns()[0]
+	Register(Pattern{Name: "plain", URL: regexp.MustCompile("^" + regexp.QuoteMeta(srv.URL) + "/plain/")})
+	Register(Pattern{Name: "test", URL: regexp.MustCompile("^" + regexp.QuoteMeta(srv.URL) + "/p/"), Link: dlProtect.Link, Confirm: true})
+	return srv
+}
+
+func TestUnwrap(t *testing.T) {
+	srv := serveProtector(t)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/p/link", "https://1fichier.com/?k3y9x2&af=4242"},
+		{"/p/continue", "https://1fichier.com/?k3y9x2&af=4242"},
+		{"/p/nested", "https://1fichier.com/?k3y9x2&af=4242"},
+		{"/p/redirect", "https://1fichier.com/?redirected"},
+		{"/plain/page", "https://1fichier.com/?plain42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := Unwrap(context.Background(), srv.URL+tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Unwrap = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapErrors(t *testing.T) {
+	srv := serveProtector(t)
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/p/captcha", ErrCaptchaRequired},
+		{"/p/nolink", ErrNoLink},
+		{"/p/loop", ErrNoLink},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := Unwrap(context.Background(), srv.URL+tt.path)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Unwrap = %q, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapLeavesOtherLinks(t *testing.T) {
+	const link = "https://1fichier.com/?abc"
+	if got, err := Unwrap(context.Background(), link); err != nil || got != link {
+		t.Errorf("Unwrap = %q, %v; want the link unchanged", got, err)
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	base, _ := url.Parse("https://dl-protect.link/abc123")
+	tests := []struct {
+		fixture string
+		action  string
+		values  url.Values
+		ok      bool
+	}{
+		{
+			fixture: "continue.html",
+			action:  "https://dl-protect.link/go?step=2&ref=zt",
+			values:  url.Values{"_token": {"f00dcafe"}, "subform": {"unlock"}, "submit": {"Continuer"}},
+			ok:      true,
+		},
+		{
+			fixture: "captcha.html",
+			action:  "https://dl-protect.link/abc123",
+			values:  url.Values{"_token": {"f00dcafe"}, "submit": {"Continuer"}},
+			ok:      true,
+		},
+		{fixture: "link.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			action, values, ok := parseForm(fixture(t, tt.fixture), base)
+			if ok != tt.ok || action != tt.action || !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("parseForm = %q, %v, %v; want %q, %v, %v", action, values, ok, tt.action, tt.values, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDefaultPatterns(t *testing.T) {
+	for _, link := range []string{"https://dl-protect.link/abc123", "https://www.dl-protect1.net/xyz"} {
+		if !Match(link) {
+			t.Errorf("%s not matched", link)
+		}
+	}
+	if Match("https://1fichier.com/?abc") {
+		t.Error("1fichier link matched as protected")
+	}
+}
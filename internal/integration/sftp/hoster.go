@@ -0,0 +1,336 @@
+// Package sftp reads sftp:// links over SSH. The path of a link is absolute on the server. The
+// username comes from the URL, the download's basic auth or the credentials saved for the host,
+// which also hold the password or private key and the server's host key. A host with no saved
+// key has the key it shows on the first connection saved, and any later connection presenting
+// another key is refused.
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration"
+	pkgsftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// timeout bounds connecting and the SSH handshake; transfers themselves are not limited.
+const timeout = 10 * time.Second
+
+func init() {
+	integration.Register(hoster{})
+}
+
+type hoster struct{}
+
+// findCredential, credentialHosts and pinHostKey reach the saved credentials. They are variables so tests can run
+// without a database.
+var (
+	findCredential  = database.FindCredential
+	credentialHosts = database.CredentialHosts
+	pinHostKey      = database.PinHostKey
+)
+
+// ErrHostKeyMismatch is returned, wrapped, when a server presents another key than the one pinned.
+var ErrHostKeyMismatch = errors.New("host key mismatch")
+
+func (hoster) Name() string { return "SFTP" }
+
+func (hoster) Match(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme == "sftp" && u.Host != ""
+}
+
+// Resolve is not used: files are read with Open.
+func (hoster) Resolve(ctx context.Context, rawURL string, opts integration.Options) (*integration.DirectLink, error) {
+	return &integration.DirectLink{URL: rawURL}, nil
+}
+
+func (hoster) Info(ctx context.Context, rawURL string, opts integration.Options) (*integration.FileInfo, error) {
+	conn, u, err := connect(ctx, rawURL, opts.Login)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stat, err := conn.Stat(u.Path)
+	if err != nil {
+		return nil, failure("stat "+u.Path, err)
+	}
+	info := &integration.FileInfo{Filename: path.Base(u.Path)}
+	if stat.Mode().IsRegular() {
+		info.Size = stat.Size()
+	}
+	return info, nil
+}
+
+// Open reads the file from offset.
+func (hoster) Open(ctx context.Context, rawURL string, offset int64, opts integration.Options) (*integration.Stream, error) {
+	conn, u, err := connect(ctx, rawURL, opts.Login)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := conn.Open(u.Path)
+	if err != nil {
+		conn.Close()
+		return nil, failure("open "+u.Path, err)
+	}
+	size := int64(-1)
+	if stat, err := file.Stat(); err == nil {
+		size = stat.Size()
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			offset = 0
+		}
+	}
+
+	s := &stream{file: file, conn: conn}
+	s.stop = context.AfterFunc(ctx, s.close)
+	return &integration.Stream{ReadCloser: s, Offset: offset, Size: size, Filename: path.Base(u.Path)}, nil
+}
+
+// Expand lists every file under a directory link, recursively.
+func (hoster) Expand(ctx context.Context, rawURL string, opts integration.Options) ([]integration.Entry, error) {
+	conn, u, err := connect(ctx, rawURL, opts.Login)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	root := u.Path
+	if root == "" {
+		root = "/"
+	}
+	stat, err := conn.Stat(root)
+	if err != nil {
+		return nil, failure("stat "+root, err)
+	}
+	if !stat.IsDir() {
+		return nil, nil
+	}
+	root = strings.TrimSuffix(root, "/") + "/"
+
+	entries := []integration.Entry{}
+	walker := conn.Walk(root)
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := walker.Err(); err != nil {
+			return nil, failure("list "+walker.Path(), err)
+		}
+		if !walker.Stat().Mode().IsRegular() {
+			continue
+		}
+		rel := strings.TrimPrefix(walker.Path(), root)
+		file := *u
+		file.User = nil
+		file.Path = root + rel
+		dir := path.Dir(rel)
+		if dir == "." {
+			dir = ""
+		}
+		entries = append(entries, integration.Entry{URL: file.String(), Filename: path.Base(rel), Size: walker.Stat().Size(), Dir: dir})
+	}
+	return entries, nil
+}
+
+// Check logs in to every host SFTP credentials are saved for. Links to other hosts carry their
+// own login, so without saved credentials there is nothing to check.
+func (hoster) Check(ctx context.Context) (string, error) {
+	hosts, err := credentialHosts(ctx, "sftp")
+	if err != nil {
+		return "", fmt.Errorf("failed to read saved credentials: %w", err)
+	}
+	if len(hosts) == 0 {
+		return "", fmt.Errorf("%w: no saved credentials", integration.ErrNotChecked)
+	}
+	for _, host := range hosts {
+		c, _, err := connect(ctx, "sftp://"+host+"/", nil)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", host, err)
+		}
+		c.Close()
+	}
+	return fmt.Sprintf("Logged in to %d saved hosts", len(hosts)), nil
+}
+
+// client is an SFTP session with the SSH connection it runs on.
+type client struct {
+	*pkgsftp.Client
+	ssh *ssh.Client
+}
+
+func (c *client) Close() error {
+	c.Client.Close()
+	return c.ssh.Close()
+}
+
+// connect opens an SFTP session on the link's server.
+func connect(ctx context.Context, rawURL string, login *url.Userinfo) (*client, *url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	config, err := clientConfig(ctx, u, login)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	netConn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("network error: %w", err)
+	}
+	netConn.SetDeadline(time.Now().Add(timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+	if err != nil {
+		netConn.Close()
+		if errors.Is(err, ErrHostKeyMismatch) {
+			return nil, nil, err
+		}
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, nil, fmt.Errorf("login as %s: %w", config.User, integration.ErrUnauthorized)
+		}
+		return nil, nil, fmt.Errorf("ssh handshake: %w", err)
+	}
+	netConn.SetDeadline(time.Time{})
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	sftpClient, err := pkgsftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, nil, fmt.Errorf("start sftp: %w", err)
+	}
+	return &client{Client: sftpClient, ssh: sshClient}, u, nil
+}
+
+// clientConfig builds the SSH login from the URL, or login, and the credentials saved for its host.
+func clientConfig(ctx context.Context, u *url.URL, login *url.Userinfo) (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{Timeout: timeout}
+
+	cred, err := findCredential(ctx, "sftp", u.Host, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved credentials: %w", err)
+	}
+	// The key is pinned on the saved credential, or on a new one for the link's host.
+	pinHost, hostKey := u.Host, ""
+	if cred != nil {
+		pinHost, hostKey = cred.Host, cred.HostKey
+		config.User = cred.Username
+		if cred.PrivateKey != "" {
+			signer, err := ssh.ParsePrivateKey([]byte(cred.PrivateKey))
+			if err != nil {
+				return nil, fmt.Errorf("saved private key for %s: %w", cred.Host, err)
+			}
+			config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+		}
+		if cred.Password != "" {
+			config.Auth = append(config.Auth, ssh.Password(cred.Password))
+		}
+	}
+	if hostKey != "" {
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey)); err != nil {
+			return nil, fmt.Errorf("saved host key for %s: %w", pinHost, err)
+		}
+	}
+	config.HostKeyCallback = checkHostKey(ctx, pinHost, hostKey)
+
+	if u.User != nil {
+		login = u.User
+	}
+	if login != nil {
+		config.User = login.Username()
+		if password, ok := login.Password(); ok {
+			config.Auth = append([]ssh.AuthMethod{ssh.Password(password)}, config.Auth...)
+		}
+	}
+	if config.User == "" {
+		return nil, fmt.Errorf("no username for %s: %w", u.Host, integration.ErrUnauthorized)
+	}
+	return config, nil
+}
+
+// checkHostKey accepts the server key saved for host. With none saved, the key presented is
+// saved, unless another connection pinned one first, in which case that one must match.
+func checkHostKey(ctx context.Context, host, saved string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		if saved == "" {
+			pinned, err := pinHostKey(ctx, "sftp", host, presented)
+			if err != nil {
+				return fmt.Errorf("failed to save host key of %s: %w", host, err)
+			}
+			if pinned == presented {
+				log.Printf("sftp: pinned host key of %s: %s", host, ssh.FingerprintSHA256(key))
+				return nil
+			}
+			saved = pinned
+		}
+		want, _, _, _, err := ssh.ParseAuthorizedKey([]byte(saved))
+		if err != nil {
+			return fmt.Errorf("saved host key for %s: %w", host, err)
+		}
+		if !bytes.Equal(want.Marshal(), key.Marshal()) {
+			return fmt.Errorf("%s presented %s, expected %s: %w",
+				host, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(want), ErrHostKeyMismatch)
+		}
+		return nil
+	}
+}
+
+// failure maps SFTP status errors to the integration errors.
+func failure(action string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%s: %w", action, integration.ErrNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%s: %w", action, integration.ErrUnauthorized)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// stream is a file being read. Closing it, or cancelling the context it was opened with, ends
+// the session.
+type stream struct {
+	file *pkgsftp.File
+	conn *client
+	stop func() bool
+	once sync.Once
+	err  error
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	return s.file.Read(p)
+}
+
+func (s *stream) Close() error {
+	s.stop()
+	s.close()
+	return s.err
+}
+
+func (s *stream) close() {
+	s.once.Do(func() {
+		s.file.Close()
+		s.err = s.conn.Close()
+	})
+}
@@ -0,0 +1,211 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"github.com/gautch29/downloader-backend/internal/model"
+	pkgsftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSFTP runs an SSH server accepting me/secret and serving the local filesystem over SFTP.
+// It returns the server's address and its host key in authorized_keys format.
+func serveSFTP(t *testing.T) (string, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "me" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config)
+		}
+	}()
+	return ln.Addr().String(), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					if server, err := pkgsftp.NewServer(channel); err == nil {
+						server.Serve()
+					}
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+// fakeCredentials stands in for the credentials table: saved is the host key saved for every
+// host, and pinned collects the keys pinned since.
+type fakeCredentials struct {
+	mu     sync.Mutex
+	saved  string
+	pinned []string
+}
+
+func setup(t *testing.T, creds *fakeCredentials) (root, base, hostKey string) {
+	t.Helper()
+	savedFind, savedPin := findCredential, pinHostKey
+	findCredential = func(ctx context.Context, protocol, host, hostname string) (*model.Credential, error) {
+		creds.mu.Lock()
+		defer creds.mu.Unlock()
+		if creds.saved == "" {
+			return nil, nil
+		}
+		return &model.Credential{Protocol: protocol, Host: host, HostKey: creds.saved}, nil
+	}
+	pinHostKey = func(ctx context.Context, protocol, host, key string) (string, error) {
+		creds.mu.Lock()
+		defer creds.mu.Unlock()
+		if creds.saved == "" {
+			creds.saved = key
+			creds.pinned = append(creds.pinned, key)
+		}
+		return creds.saved, nil
+	}
+	t.Cleanup(func() { findCredential, pinHostKey = savedFind, savedPin })
+
+	addr, hostKey := serveSFTP(t)
+	// The server serves the local filesystem: links carry the absolute path of the temp dir.
+	root = t.TempDir()
+	return root, "sftp://me:secret@" + addr + filepath.ToSlash(root), hostKey
+}
+
+func TestOpenResumes(t *testing.T) {
+	root, base, _ := setup(t, &fakeCredentials{})
+	data := []byte(strings.Repeat("0123456789", 1000))
+	os.WriteFile(filepath.Join(root, "movie.mkv"), data, 0o644)
+
+	stream, err := hoster{}.Open(context.Background(), base+"/movie.mkv", 2500, integration.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	got, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.Offset != 2500 || stream.Size != int64(len(data)) || stream.Filename != "movie.mkv" {
+		t.Errorf("stream = offset %d, size %d, name %q", stream.Offset, stream.Size, stream.Filename)
+	}
+	if string(got) != string(data[2500:]) {
+		t.Errorf("read %d bytes, want the %d after the offset", len(got), len(data)-2500)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	root, base, _ := setup(t, &fakeCredentials{})
+	os.MkdirAll(filepath.Join(root, "show", "Season 01"), 0o755)
+	os.WriteFile(filepath.Join(root, "show", "info.nfo"), []byte("nfo"), 0o644)
+	os.WriteFile(filepath.Join(root, "show", "Season 01", "e01.mkv"), []byte("episode"), 0o644)
+
+	// The login is given apart from the link, as for a queued download, and is not copied into
+	// the links of the files.
+	link, login := integration.SplitLogin(base + "/show")
+	entries, err := hoster{}.Expand(context.Background(), link, integration.Options{Login: login})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	want := []integration.Entry{
+		{URL: link + "/Season%2001/e01.mkv", Filename: "e01.mkv", Size: 7, Dir: "Season 01"},
+		{URL: link + "/info.nfo", Filename: "info.nfo", Size: 3},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v\nwant %+v", entries, want)
+	}
+}
+
+func TestBadLogin(t *testing.T) {
+	_, base, _ := setup(t, &fakeCredentials{})
+	base = strings.Replace(base, "me:secret", "me:wrong", 1)
+	_, err := hoster{}.Info(context.Background(), base, integration.Options{})
+	if !errors.Is(err, integration.ErrUnauthorized) {
+		t.Errorf("error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestHostKeyPinnedOnFirstConnection(t *testing.T) {
+	creds := &fakeCredentials{}
+	_, base, hostKey := setup(t, creds)
+
+	for range 2 {
+		if _, err := (hoster{}).Info(context.Background(), base, integration.Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(creds.pinned, []string{hostKey}) {
+		t.Errorf("pinned %q, want the server key once", creds.pinned)
+	}
+}
+
+func TestHostKeyMismatch(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewPublicKey(pub)
+	creds := &fakeCredentials{saved: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other)))}
+	_, base, _ := setup(t, creds)
+
+	_, err := hoster{}.Info(context.Background(), base, integration.Options{})
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Errorf("error = %v, want ErrHostKeyMismatch", err)
+	}
+	if len(creds.pinned) != 0 {
+		t.Errorf("pinned %q over the saved key", creds.pinned)
+	}
+}
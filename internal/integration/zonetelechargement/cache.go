@@ -0,0 +1,137 @@
+package zonetelechargement
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// PageKind is the kind of page fetched from the site; each kind is cached for its own time.
+type PageKind string
+
+const (
+	PageSearch  PageKind = "search"
+	PageRelease PageKind = "release"
+)
+
+// maxCacheEntries bounds the in-memory cache; the entries closest to expiry are dropped first.
+const maxCacheEntries = 500
+
+// cachePurgeInterval is how often expired pages are deleted from Postgres.
+const cachePurgeInterval = time.Hour
+
+// cachedPage is a page body as received, with the URL it was finally served from.
+type cachedPage struct {
+	body     []byte
+	finalURL string
+	expires  time.Time
+}
+
+// pageCache keeps fetched pages by URL, in memory and optionally in the scraper_cache table.
+// It is shared by every Client.
+type pageCache struct {
+	mu       sync.Mutex
+	pages    map[string]cachedPage
+	purgedAt time.Time
+
+	hits, misses atomic.Int64
+}
+
+var cache = &pageCache{pages: make(map[string]cachedPage)}
+
+// CacheStats are the counters of the scraper cache since the server started.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int // pages held in memory
+}
+
+// Stats returns the cache counters.
+func Stats() CacheStats {
+	cache.mu.Lock()
+	entries := len(cache.pages)
+	cache.mu.Unlock()
+	return CacheStats{Hits: cache.hits.Load(), Misses: cache.misses.Load(), Entries: entries}
+}
+
+// get returns the cached page for key, looking in Postgres too when persist is set, and counts
+// the hit or miss.
+func (c *pageCache) get(ctx context.Context, key string, persist bool) (*cachedPage, bool) {
+	c.mu.Lock()
+	page, ok := c.pages[key]
+	if ok && time.Now().After(page.expires) {
+		delete(c.pages, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok && persist {
+		err := database.Pool.QueryRow(ctx,
+			"SELECT body, final_url, expires_at FROM scraper_cache WHERE url=$1 AND expires_at > NOW()", key,
+		).Scan(&page.body, &page.finalURL, &page.expires)
+		if err == nil {
+			ok = true
+			c.remember(key, page)
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("zonetelechargement: failed to read cached page: %v", err)
+		}
+	}
+
+	if ok {
+		c.hits.Add(1)
+		return &page, true
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// put caches a page for ttl.
+func (c *pageCache) put(ctx context.Context, key string, page cachedPage, ttl time.Duration, persist bool) {
+	page.expires = time.Now().Add(ttl)
+	c.remember(key, page)
+	if !persist {
+		return
+	}
+
+	_, err := database.Pool.Exec(ctx, `
+		INSERT INTO scraper_cache (url, final_url, body, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (url) DO UPDATE SET final_url=EXCLUDED.final_url, body=EXCLUDED.body, expires_at=EXCLUDED.expires_at`,
+		key, page.finalURL, page.body, page.expires)
+	if err != nil {
+		log.Printf("zonetelechargement: failed to store cached page: %v", err)
+	}
+
+	c.mu.Lock()
+	purge := time.Since(c.purgedAt) > cachePurgeInterval
+	if purge {
+		c.purgedAt = time.Now()
+	}
+	c.mu.Unlock()
+	if purge {
+		if _, err := database.Pool.Exec(ctx, "DELETE FROM scraper_cache WHERE expires_at <= NOW()"); err != nil {
+			log.Printf("zonetelechargement: failed to purge cached pages: %v", err)
+		}
+	}
+}
+
+// remember keeps a page in memory, making room when the cache is full.
+func (c *pageCache) remember(key string, page cachedPage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pages[key]; !ok && len(c.pages) >= maxCacheEntries {
+		var oldest string
+		for k, p := range c.pages {
+			if oldest == "" || p.expires.Before(c.pages[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.pages, oldest)
+	}
+	c.pages[key] = page
+}
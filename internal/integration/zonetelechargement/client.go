@@ -1,27 +1,105 @@
+// Package zonetelechargement scrapes Zone-Telechargement, the site movies and series are searched
+// on. It has no API: results are parsed from the site's HTML pages.
 package zonetelechargement
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"golang.org/x/net/html"
 )
 
-const BaseURL = "https://www.zone-telechargement.cam" // This domain changes often, likely needs config
+// maxPageSize bounds how much of a page is read.
+const maxPageSize = 5 << 20
+
+// Client scrapes one Zone-Telechargement domain. NewDefaultClient uses the domain in use.
+type Client struct {
+	baseURL *url.URL
+	opts    Options
+	http    *http.Client
+}
+
+func NewClient(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", baseURL)
+	}
+	return &Client{
+		baseURL: u,
+		opts:    opts,
+		http:    opts.httpClient(15 * time.Second),
+	}, nil
+}
 
-func CheckConnectivity() error {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+// get fetches a page of the site, or takes it from the cache, and parses it. Only the path and
+// query of ref are used, so links saved from another domain of the site still work.
+func (c *Client) get(ctx context.Context, kind PageKind, ref string) (*html.Node, *url.URL, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid page URL: %w", err)
+	}
+	target, err := c.baseURL.Parse(u.RequestURI())
+	if err != nil {
+		return nil, nil, err
+	}
+	ttl := c.opts.CacheTTL[kind]
+	if ttl > 0 {
+		if page, ok := cache.get(ctx, target.String(), c.opts.Persist); ok {
+			return parsePage(page)
+		}
 	}
 
-	resp, err := client.Get(BaseURL)
+	if err := limiter.wait(ctx, target.Host, c.opts.RequestInterval); err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
 	if err != nil {
-		return fmt.Errorf("unreachable: %w", err)
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("Accept-Language", "fr-FR,fr;q=0.9,en;q=0.5")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("network error: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("returned status: %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil, fmt.Errorf("%s returned %s: %w", target.Host, resp.Status, integration.ErrNotFound)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, nil, fmt.Errorf("%s returned %s: %w", target.Host, resp.Status, integration.ErrRateLimited)
+	case resp.StatusCode >= 400:
+		return nil, nil, fmt.Errorf("%s returned %s", target.Host, resp.Status)
 	}
 
-	return nil
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("network error: %w", err)
+	}
+	page := cachedPage{body: body, finalURL: resp.Request.URL.String()}
+	if ttl > 0 {
+		cache.put(ctx, target.String(), page, ttl, c.opts.Persist)
+	}
+	return parsePage(&page)
+}
+
+// parsePage parses a fetched page and returns it with the URL it was served from.
+func parsePage(page *cachedPage) (*html.Node, *url.URL, error) {
+	pageURL, err := url.Parse(page.finalURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(page.body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", pageURL, err)
+	}
+	return doc, pageURL, nil
 }
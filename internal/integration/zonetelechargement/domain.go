@@ -0,0 +1,228 @@
+package zonetelechargement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/html"
+)
+
+// Settings keys for the site's domain, which changes often.
+const (
+	// SettingBaseURL is the domain in use, e.g. "https://www.zone-telechargement.cam".
+	SettingBaseURL = "zoneTelechargementUrl"
+	// SettingBaseURLChangedAt is when the domain in use last changed, in RFC 3339.
+	SettingBaseURLChangedAt = "zoneTelechargementUrlChangedAt"
+	// SettingMirrors is a JSON array of extra domains to try when the one in use stops answering.
+	SettingMirrors = "zoneTelechargementMirrors"
+)
+
+// DefaultBaseURL is used until a domain is stored.
+const DefaultBaseURL = "https://www.zone-telechargement.cam"
+
+// Mirrors are domains the site has used, tried after the stored mirrors when the domain in use
+// stops answering.
+var Mirrors = []string{
+	"https://www.zone-telechargement.cam",
+	"https://www.zone-telechargement.homes",
+	"https://www.zone-telechargement.diy",
+	"https://www.zone-telechargement.ing",
+	"https://www.zone-telechargement.lol",
+	"https://www.zone-telechargement.mom",
+}
+
+// Domain is the site's domain in use.
+type Domain struct {
+	URL string
+	// ChangedAt is when the domain was last changed, zero when it never was.
+	ChangedAt time.Time
+}
+
+// CurrentDomain returns the stored domain, or DefaultBaseURL.
+func CurrentDomain(ctx context.Context) (Domain, error) {
+	settings, err := database.GetSettings(ctx, SettingBaseURL, SettingBaseURLChangedAt)
+	if err != nil {
+		return Domain{URL: DefaultBaseURL}, err
+	}
+	d := Domain{URL: settings[SettingBaseURL]}
+	if d.URL == "" {
+		d.URL = DefaultBaseURL
+	}
+	d.ChangedAt, _ = time.Parse(time.RFC3339, settings[SettingBaseURLChangedAt])
+	return d, nil
+}
+
+// NewDefaultClient returns a client for the domain in use.
+func NewDefaultClient(ctx context.Context) (*Client, error) {
+	d, err := CurrentDomain(ctx)
+	if err != nil {
+		log.Printf("zonetelechargement: failed to read the stored domain, using %s: %v", d.URL, err)
+	}
+	opts, err := LoadOptions(ctx)
+	if err != nil {
+		log.Printf("zonetelechargement: failed to read the scraper settings, using the defaults: %v", err)
+	}
+	return NewClient(d.URL, opts)
+}
+
+// NormalizeBaseURL reduces a URL of the site to its scheme and host.
+func NormalizeBaseURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q", rawURL)
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
+}
+
+// SetBaseURL stores the domain in use, recording when it changed.
+func SetBaseURL(ctx context.Context, baseURL string) error {
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := StoreBaseURL(ctx, tx, baseURL); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// StoreBaseURL is SetBaseURL within tx, so the domain can be saved along with other settings.
+func StoreBaseURL(ctx context.Context, tx pgx.Tx, baseURL string) error {
+	baseURL, err := NormalizeBaseURL(baseURL)
+	if err != nil {
+		return err
+	}
+	current := DefaultBaseURL
+	err = tx.QueryRow(ctx, "SELECT value FROM settings WHERE key = $1", SettingBaseURL).Scan(&current)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if current == baseURL {
+		return nil
+	}
+	upsert := `INSERT INTO settings (key, value) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`
+	if _, err := tx.Exec(ctx, upsert, SettingBaseURL, baseURL); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, upsert, SettingBaseURLChangedAt, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// CheckConnectivity checks that the domain in use answers. When it has moved, by redirecting
+// or by no longer answering while a mirror does, the new domain is stored. It returns the
+// domain in use afterwards and whether it changed.
+func CheckConnectivity(ctx context.Context) (Domain, bool, error) {
+	current, err := CurrentDomain(ctx)
+	if err != nil {
+		return current, false, fmt.Errorf("failed to read the stored domain: %w", err)
+	}
+	opts, err := LoadOptions(ctx)
+	if err != nil {
+		return current, false, fmt.Errorf("failed to read the scraper settings: %w", err)
+	}
+
+	origin, probeErr := probe(ctx, current.URL, opts)
+	if probeErr == nil && origin == current.URL {
+		return current, false, nil
+	}
+	if probeErr != nil {
+		if origin, err = discover(ctx, current.URL, opts); err != nil {
+			return current, false, fmt.Errorf("%s unreachable (%v) and %w", current.URL, probeErr, err)
+		}
+	}
+
+	log.Printf("zonetelechargement: domain moved from %s to %s", current.URL, origin)
+	if err := SetBaseURL(ctx, origin); err != nil {
+		return current, false, fmt.Errorf("failed to record the new domain %s: %w", origin, err)
+	}
+	updated, err := CurrentDomain(ctx)
+	return updated, true, err
+}
+
+// ErrNoMirror is returned, wrapped, when no candidate domain answers.
+var ErrNoMirror = errors.New("no mirror answered")
+
+// discover tries the stored mirrors, then the known ones, and returns the first that answers.
+func discover(ctx context.Context, current string, opts Options) (string, error) {
+	var candidates []string
+	if settings, err := database.GetSettings(ctx, SettingMirrors); err == nil && settings[SettingMirrors] != "" {
+		if err := json.Unmarshal([]byte(settings[SettingMirrors]), &candidates); err != nil {
+			log.Printf("zonetelechargement: ignoring invalid %s setting: %v", SettingMirrors, err)
+		}
+	}
+	candidates = append(candidates, Mirrors...)
+
+	tried := map[string]bool{current: true}
+	for _, candidate := range candidates {
+		candidate, err := NormalizeBaseURL(candidate)
+		if err != nil || tried[candidate] {
+			continue
+		}
+		tried[candidate] = true
+		if origin, err := probe(ctx, candidate, opts); err == nil {
+			return origin, nil
+		} else if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", ErrNoMirror
+}
+
+// probe loads a domain's home page, following redirects, and returns the domain it ended on
+// when the page is the site's (see isSitePage).
+func probe(ctx context.Context, baseURL string, opts Options) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if err := limiter.wait(ctx, u.Host, opts.RequestInterval); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", opts.UserAgent)
+	resp, err := opts.httpClient(5 * time.Second).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("returned status: %s", resp.Status)
+	}
+
+	doc, err := html.Parse(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("unreachable: %w", err)
+	}
+	if !isSitePage(doc) {
+		return "", fmt.Errorf("%s does not look like Zone-Telechargement", resp.Request.URL.Host)
+	}
+	return NormalizeBaseURL(resp.Request.URL.String())
+}
+
+// isSitePage reports whether a page has the site's structure: its search form or the
+// "cover_global" blocks releases are listed in. A parked domain or a copy of the site's
+// name on another page has neither.
+func isSitePage(doc *html.Node) bool {
+	if find(doc, byClass("cover_global")) != nil {
+		return true
+	}
+	return find(doc, func(n *html.Node) bool {
+		return n.Data == "form" && find(n, func(n *html.Node) bool {
+			return n.Data == "input" && attr(n, "name") == "search"
+		}) != nil
+	}) != nil
+}
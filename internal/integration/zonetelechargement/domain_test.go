@@ -0,0 +1,87 @@
+package zonetelechargement
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serveHome serves testdata/fixture as the home page of a test domain.
+func serveHome(t *testing.T, fixture string) *httptest.Server {
+	t.Helper()
+	page, err := os.ReadFile("testdata/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.RequestInterval = 0
+	return opts
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		fixture string
+		ok      bool
+	}{
+		{"home.html", true},
+		{"home_search_only.html", true},
+		{"search_movies.html", true},
+		{"parked.html", false},
+		{"release_movie.html", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			srv := serveHome(t, tt.fixture)
+			origin, err := probe(context.Background(), srv.URL, testOptions())
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("probe = %q, want an error", origin)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if origin != srv.URL {
+				t.Errorf("probe = %q, want %q", origin, srv.URL)
+			}
+		})
+	}
+}
+
+func TestProbeFollowsMove(t *testing.T) {
+	moved := serveHome(t, "home.html")
+	old := httptest.NewServer(http.RedirectHandler(moved.URL+"/", http.StatusMovedPermanently))
+	defer old.Close()
+
+	origin, err := probe(context.Background(), old.URL, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin != moved.URL {
+		t.Errorf("probe = %q, want %q", origin, moved.URL)
+	}
+}
+
+func TestProbeErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "zone-telechargement is down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := probe(context.Background(), srv.URL, testOptions())
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("probe error = %v, want the status", err)
+	}
+}
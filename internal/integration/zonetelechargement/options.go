@@ -0,0 +1,113 @@
+package zonetelechargement
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gautch29/downloader-backend/internal/database"
+	"github.com/gautch29/downloader-backend/internal/integration"
+)
+
+// Settings keys controlling how the site is scraped.
+const (
+	// SettingUserAgent is the User-Agent header sent to the site.
+	SettingUserAgent = "zoneTelechargementUserAgent"
+	// SettingProxy is an http, https or socks5 proxy URL requests to the site go through; empty for none.
+	SettingProxy = "zoneTelechargementProxy"
+	// SettingRequestInterval is the minimum delay between two requests to the same host, in milliseconds.
+	SettingRequestInterval = "zoneTelechargementRequestInterval"
+	// SettingSearchCacheTTL and SettingReleaseCacheTTL are how long search and release pages are
+	// cached, in seconds; 0 disables caching.
+	SettingSearchCacheTTL  = "zoneTelechargementSearchCacheTtl"
+	SettingReleaseCacheTTL = "zoneTelechargementReleaseCacheTtl"
+	// SettingCachePersist keeps cached pages in Postgres as well, so they survive restarts.
+	SettingCachePersist = "zoneTelechargementCachePersist"
+)
+
+// DefaultUserAgent is sent until another is configured: the site turns away clients that do not
+// look like a browser.
+const DefaultUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+const (
+	DefaultRequestInterval = time.Second
+	DefaultSearchCacheTTL  = 15 * time.Minute
+	DefaultReleaseCacheTTL = time.Hour
+)
+
+// Options control how a Client reaches the site.
+type Options struct {
+	UserAgent string
+	Proxy     *url.URL
+	// RequestInterval is the minimum delay between two requests to the same host.
+	RequestInterval time.Duration
+	// CacheTTL is how long pages of each kind are cached; a kind missing or 0 is not cached.
+	CacheTTL map[PageKind]time.Duration
+	// Persist keeps cached pages in Postgres as well.
+	Persist bool
+}
+
+// DefaultOptions are used for settings that have never been saved.
+func DefaultOptions() Options {
+	return Options{
+		UserAgent:       DefaultUserAgent,
+		RequestInterval: DefaultRequestInterval,
+		CacheTTL:        map[PageKind]time.Duration{PageSearch: DefaultSearchCacheTTL, PageRelease: DefaultReleaseCacheTTL},
+	}
+}
+
+// ParseProxy validates a proxy URL. An empty string means no proxy.
+func ParseProxy(value string) (*url.URL, error) {
+	if value == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", value)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+}
+
+// LoadOptions reads the options from the stored settings, falling back to the defaults for
+// settings that are missing or invalid.
+func LoadOptions(ctx context.Context) (Options, error) {
+	opts := DefaultOptions()
+	settings, err := database.GetSettings(ctx, SettingUserAgent, SettingProxy, SettingRequestInterval,
+		SettingSearchCacheTTL, SettingReleaseCacheTTL, SettingCachePersist)
+	if err != nil {
+		return opts, err
+	}
+	if v := settings[SettingUserAgent]; v != "" {
+		opts.UserAgent = v
+	}
+	if proxy, err := ParseProxy(settings[SettingProxy]); err == nil {
+		opts.Proxy = proxy
+	}
+	if ms, err := strconv.Atoi(settings[SettingRequestInterval]); err == nil && ms >= 0 {
+		opts.RequestInterval = time.Duration(ms) * time.Millisecond
+	}
+	if s, err := strconv.Atoi(settings[SettingSearchCacheTTL]); err == nil && s >= 0 {
+		opts.CacheTTL[PageSearch] = time.Duration(s) * time.Second
+	}
+	if s, err := strconv.Atoi(settings[SettingReleaseCacheTTL]); err == nil && s >= 0 {
+		opts.CacheTTL[PageRelease] = time.Duration(s) * time.Second
+	}
+	opts.Persist = settings[SettingCachePersist] == "true"
+	return opts, nil
+}
+
+// httpClient returns a client going through the configured proxy.
+func (o Options) httpClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.Proxy != nil {
+		transport.Proxy = http.ProxyURL(o.Proxy)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: integration.CheckRedirect}
+}
@@ -0,0 +1,39 @@
+package zonetelechargement
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces out requests to each host, so scraping does not get the server's IP
+// banned. It is shared by every Client.
+type hostLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time // earliest time for the next request, per host
+}
+
+var limiter = &hostLimiter{next: make(map[string]time.Time)}
+
+// wait blocks until a request to host is allowed, at least interval after the previous one,
+// and reserves it.
+func (l *hostLimiter) wait(ctx context.Context, host string, interval time.Duration) error {
+	l.mu.Lock()
+	at := time.Now()
+	if next := l.next[host]; next.After(at) {
+		at = next
+	}
+	l.next[host] = at.Add(interval)
+	l.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
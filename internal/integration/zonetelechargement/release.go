@@ -0,0 +1,224 @@
+package zonetelechargement
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gautch29/downloader-backend/internal/integration"
+	"github.com/gautch29/downloader-backend/internal/integration/protector"
+	"golang.org/x/net/html"
+)
+
+// maxVersions bounds how many other versions of a release are fetched along with it. Every page
+// of a version that is fetched is, so a season split over several pages is never cut short.
+const maxVersions = 8
+
+// Release is a movie or series season with the download links of each of its versions.
+type Release struct {
+	Title string `json:"title"`
+	// Show and Season are set for a series season, parsed from a title such as "Show - Saison 2".
+	Show      string      `json:"show,omitempty"`
+	Season    int         `json:"season,omitempty"`
+	Year      int         `json:"year,omitempty"`
+	PosterURL string      `json:"posterUrl,omitempty"`
+	URL       string      `json:"url"`
+	Groups    []LinkGroup `json:"groups"`
+}
+
+// LinkGroup is one version of a release, such as 1080p MULTI, with its links at each hoster.
+// Each hoster holds a full copy: one is enough to get the release.
+type LinkGroup struct {
+	Quality  string        `json:"quality"`
+	Language string        `json:"language"`
+	PageURL  string        `json:"pageUrl"`
+	Hosters  []HosterLinks `json:"hosters"`
+}
+
+// HosterLinks are the links to one version at one hoster: a single link, the parts of a
+// multi-part archive or one link per episode.
+type HosterLinks struct {
+	Hoster string `json:"hoster"`
+	Links  []Link `json:"links"`
+}
+
+// Link is a download link, usually wrapped in a link protector (see package protector).
+type Link struct {
+	URL     string `json:"url"`
+	Label   string `json:"label,omitempty"`   // e.g. "Episode 3" or "Partie 2"
+	Episode int    `json:"episode,omitempty"` // parsed from the label
+}
+
+// Release reads a release page, as found in Result.DetailURL, and the pages of its other
+// versions, and returns every version with its links. Versions whose page fails to load are
+// left out. Only the path and query of rawURL are used: the page is always read from the
+// client's domain.
+//
+// Versions are told apart by the quality and language of the links to them: past maxVersions,
+// only more pages of the versions already fetched, such as the rest of a season's episodes,
+// are read.
+func (c *Client) Release(ctx context.Context, rawURL string) (*Release, error) {
+	doc, pageURL, err := c.get(ctx, PageRelease, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	release, group, others := parseRelease(doc, pageURL)
+
+	release.Groups = append(release.Groups, group)
+	seen := map[string]bool{group.PageURL: true}
+	versions := map[string]bool{versionKey(group): true}
+	for _, other := range others {
+		key := versionKey(other)
+		if seen[other.PageURL] || (!versions[key] && len(versions) > maxVersions) {
+			continue
+		}
+		seen[other.PageURL] = true
+		versions[key] = true
+		doc, pageURL, err := c.get(ctx, PageRelease, other.PageURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("zonetelechargement: failed to load version %s: %v", other.PageURL, err)
+			continue
+		}
+		_, version, _ := parseRelease(doc, pageURL)
+		if version.Quality == "" && version.Language == "" {
+			version.Quality, version.Language = other.Quality, other.Language
+		}
+		release.Groups = append(release.Groups, version)
+	}
+	return release, nil
+}
+
+// versionKey tells versions apart by quality and language, ignoring case.
+func versionKey(g LinkGroup) string {
+	return strings.ToLower(g.Quality + "|" + g.Language)
+}
+
+var (
+	qualityPattern = regexp.MustCompile(`(?i)Qualit[ée]\s*:?\s*(.+?)\s*\|\s*(.+)`)
+	// releaseYear also reads the year of a full date: "Date de sortie : 26 juin 2024" or "26/06/2024".
+	releaseYear = regexp.MustCompile(`(?i)(?:Ann[ée]e|Date de sortie|Sortie)[^0-9]{0,40}(?:\d{1,2}(?:\s+\pL+\.?\s+|[/.-]\d{1,2}[/.-]))?(19[0-9]{2}|20[0-9]{2})`)
+)
+
+// parseRelease extracts a release page: the release itself, the version shown on the page with
+// its links, and the other versions it points to (their links are on their own pages).
+//
+// The page gives the version as "Qualité HDLIGHT 1080p | MULTI (FRENCH)", lists the other
+// versions as links in "otherversions", and lists the download links under a heading naming
+// each hoster.
+func parseRelease(doc *html.Node, pageURL *url.URL) (*Release, LinkGroup, []LinkGroup) {
+	release := &Release{URL: pageURL.String()}
+	content := find(doc, byClass("corps"))
+	if content == nil {
+		content = doc
+	}
+	if h1 := find(content, byTag("h1")); h1 != nil {
+		release.Title = text(h1)
+	}
+	if m := titleYear.FindStringSubmatch(release.Title); m != nil {
+		release.Year, _ = strconv.Atoi(m[1])
+		release.Title = strings.TrimSpace(release.Title[:len(release.Title)-len(m[0])])
+	}
+	if show, season := ParseSeason(release.Title); season > 0 {
+		release.Show, release.Season = show, season
+	}
+	pageText := text(content)
+	if release.Year == 0 {
+		if m := releaseYear.FindStringSubmatch(pageText); m != nil {
+			release.Year, _ = strconv.Atoi(m[1])
+		}
+	}
+	if img := find(content, byTag("img")); img != nil && attr(img, "src") != "" {
+		release.PosterURL = absolute(pageURL, attr(img, "src"))
+	}
+
+	group := LinkGroup{PageURL: pageURL.String(), Hosters: parseLinks(content, pageURL)}
+	// The version is read from the smallest element holding it, so the text of what follows
+	// on the page does not run into the language.
+	var version string
+	for _, n := range findAll(content, func(*html.Node) bool { return true }) {
+		if t := text(n); qualityPattern.MatchString(t) && (version == "" || len(t) < len(version)) {
+			version = t
+		}
+	}
+	if m := qualityPattern.FindStringSubmatch(version); m != nil {
+		group.Quality, group.Language = m[1], m[2]
+	}
+
+	var others []LinkGroup
+	for _, block := range findAll(doc, byClass("otherversions")) {
+		for _, a := range findAll(block, byTag("a")) {
+			href := attr(a, "href")
+			if href == "" {
+				continue
+			}
+			other := LinkGroup{PageURL: absolute(pageURL, href)}
+			other.Quality, other.Language = parseVersion(a)
+			others = append(others, other)
+		}
+	}
+	return release, group, others
+}
+
+// parseLinks collects the download links of a page, under the hoster heading they follow: the
+// last block of text without links seen before them.
+func parseLinks(content *html.Node, pageURL *url.URL) []HosterLinks {
+	hosters := []HosterLinks{}
+	var heading string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "a":
+				link := absolute(pageURL, attr(n, "href"))
+				if !protector.Match(link) && !integration.Supports(link) {
+					return
+				}
+				if heading == "" {
+					heading = hostname(link)
+				}
+				if len(hosters) == 0 || hosters[len(hosters)-1].Hoster != heading {
+					hosters = append(hosters, HosterLinks{Hoster: heading})
+				}
+				last := &hosters[len(hosters)-1]
+				label := linkLabel(text(n))
+				last.Links = append(last.Links, Link{URL: link, Label: label, Episode: ParseEpisode(label)})
+				return
+			case n.Data == "div" || n.Data == "h2" || n.Data == "h3":
+				if find(n, byTag("a")) == nil {
+					if t := text(n); t != "" && len(t) <= 40 {
+						heading = t
+					}
+					return
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(content)
+	return hosters
+}
+
+// linkLabel keeps the text of a link when it says which part or episode it is, dropping
+// generic texts such as "Télécharger".
+func linkLabel(s string) string {
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "télécharger") || strings.HasPrefix(lower, "telecharger") || strings.HasPrefix(lower, "download") {
+		return ""
+	}
+	return s
+}
+
+func hostname(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package zonetelechargement
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/gautch29/downloader-backend/internal/integration/onefichier"
+)
+
+func TestParseRelease(t *testing.T) {
+	doc, pageURL := parseFixture(t, "release_movie.html", "/?p=film&id=31199-oppenheimer")
+	release, group, others := parseRelease(doc, pageURL)
+
+	want := &Release{
+		Title:     "Oppenheimer",
+		Year:      2023,
+		PosterURL: testSite + "/img/films/oppenheimer.jpg",
+		URL:       testSite + "/?p=film&id=31199-oppenheimer",
+	}
+	if !reflect.DeepEqual(release, want) {
+		t.Errorf("release:\n got %+v\nwant %+v", release, want)
+	}
+	if group.Quality != "BLU-RAY 1080p" || group.Language != "MULTI (TRUEFRENCH)" || group.PageURL != want.URL {
+		t.Errorf("version = %q, %q at %s", group.Quality, group.Language, group.PageURL)
+	}
+	wantOthers := []LinkGroup{
+		{Quality: "ULTRA HD 4K", Language: "MULTI", PageURL: testSite + "/?p=film&id=31200-oppenheimer-4k"},
+		{Quality: "HDLIGHT 720p", Language: "FRENCH", PageURL: testSite + "/?p=film&id=31201-oppenheimer-720p"},
+	}
+	if !reflect.DeepEqual(others, wantOthers) {
+		t.Errorf("other versions:\n got %+v\nwant %+v", others, wantOthers)
+	}
+}
+
+func TestParseReleaseSeason(t *testing.T) {
+	doc, pageURL := parseFixture(t, "release_season.html", "/?p=serie&id=4521-the-bear-saison-3")
+	release, group, others := parseRelease(doc, pageURL)
+
+	if release.Title != "The Bear - Saison 3" || release.Show != "The Bear" || release.Season != 3 || release.Year != 2024 {
+		t.Errorf("release = %+v", release)
+	}
+	if release.PosterURL != "https://img.example/the-bear-s3.jpg" {
+		t.Errorf("poster = %s", release.PosterURL)
+	}
+	if group.Quality != "WEB-DL 1080p" || group.Language != "VOSTFR" {
+		t.Errorf("version = %q, %q", group.Quality, group.Language)
+	}
+	if len(others) != 0 {
+		t.Errorf("other versions = %+v", others)
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []HosterLinks
+	}{
+		{
+			fixture: "release_movie.html",
+			want: []HosterLinks{
+				{Hoster: "1fichier", Links: []Link{{URL: "https://dl-protect.link/a1b2c3"}}},
+				{Hoster: "Uptobox", Links: []Link{
+					{URL: "https://dl-protect.link/d4e5f6", Label: "Partie 1"},
+					{URL: "https://dl-protect.link/g7h8i9", Label: "Partie 2"},
+				}},
+			},
+		},
+		{
+			fixture: "release_season.html",
+			want: []HosterLinks{
+				{Hoster: "1fichier", Links: []Link{
+					{URL: "https://1fichier.com/?ep1bear", Label: "Episode 1", Episode: 1},
+					{URL: "https://1fichier.com/?ep2bear", Label: "Épisode 2", Episode: 2},
+					{URL: "https://dl-protect.link/bear3", Label: "S03E03", Episode: 3},
+					{URL: "https://dl-protect.link/bear10", Label: "Episode 10 FINAL", Episode: 10},
+					{URL: "https://1fichier.com/?nohead"},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			doc, pageURL := parseFixture(t, tt.fixture, "/")
+			got := parseLinks(doc, pageURL)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("links:\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseYear(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Année : 2023", "2023"},
+		{"Date de sortie : 26 juin 2024", "2024"},
+		{"Date de sortie : 26/06/2024", "2024"},
+		{"Durée : 2h 31min", ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if m := releaseYear.FindStringSubmatch(tt.in); m != nil {
+			got = m[1]
+		}
+		if got != tt.want {
+			t.Errorf("year in %q = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReleaseReadsEveryPageOfAVersion(t *testing.T) {
+	// The first page of a season lists more versions than are fetched, then its own second
+	// page and the second page of another version.
+	var others strings.Builder
+	for i := 1; i <= maxVersions+2; i++ {
+		fmt.Fprintf(&others, `<a href="/v%d"><b>Version %d</b> <b>(FRENCH)</b></a>`, i, i)
+	}
+	others.WriteString(`<a href="/page2"><b>WEB-DL 1080p</b> <b>(VOSTFR)</b></a>`)
+	others.WriteString(`<a href="/v1-page2"><b>Version 1</b> <b>(FRENCH)</b></a>`)
+
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		var quality, links string
+		switch r.URL.Path {
+		case "/season":
+			quality = "WEB-DL 1080p | VOSTFR"
+			links = `<a href="https://1fichier.com/?e1">Episode 1</a><div class="otherversions">` + others.String() + `</div>`
+		case "/page2":
+			quality = "WEB-DL 1080p | VOSTFR"
+			links = `<a href="https://1fichier.com/?e2">Episode 2</a>`
+		default:
+			quality = strings.TrimPrefix(r.URL.Path, "/") + " | FRENCH"
+		}
+		fmt.Fprintf(w, `<div class="corps"><h1>Show - Saison 1</h1><div>Qualité %s</div><div>1fichier</div>%s</div>`, quality, links)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := c.Release(context.Background(), "/season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := map[string]bool{}
+	for _, path := range requested {
+		fetched[path] = true
+	}
+	for _, path := range []string{"/page2", "/v1-page2", fmt.Sprintf("/v%d", maxVersions)} {
+		if !fetched[path] {
+			t.Errorf("%s not fetched", path)
+		}
+	}
+	if fetched[fmt.Sprintf("/v%d", maxVersions+1)] {
+		t.Errorf("more than %d other versions fetched: %v", maxVersions, requested)
+	}
+	episodes := release.Episodes(release.Groups[0], "1fichier")
+	if len(episodes) != 2 || episodes[0].Episode != 1 || episodes[1].Episode != 2 {
+		t.Errorf("episodes = %+v", episodes)
+	}
+}
@@ -0,0 +1,153 @@
+package zonetelechargement
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Category is the kind of release searched for.
+type Category string
+
+const (
+	CategoryMovie  Category = "movie"
+	CategorySeries Category = "series"
+)
+
+// section is the site's name for a category, as used in its URLs.
+func (c Category) section() (string, error) {
+	switch c {
+	case CategoryMovie:
+		return "films", nil
+	case CategorySeries:
+		return "series", nil
+	}
+	return "", fmt.Errorf("unknown category %q", c)
+}
+
+// Result is one release listed by a search. Fields the page does not show are zero.
+type Result struct {
+	Title     string `json:"title"`
+	Season    int    `json:"season,omitempty"` // for series, parsed from the title
+	Year      int    `json:"year,omitempty"`
+	Quality   string `json:"quality,omitempty"`  // e.g. "BLU-RAY 1080p"
+	Language  string `json:"language,omitempty"` // e.g. "MULTI", "VOSTFR"
+	Size      int64  `json:"size,omitempty"`     // bytes
+	PosterURL string `json:"posterUrl,omitempty"`
+	DetailURL string `json:"detailUrl"`
+}
+
+// Search lists the releases matching query in a category, as shown on the first results page.
+func (c *Client) Search(ctx context.Context, query string, category Category) ([]Result, error) {
+	section, err := category.section()
+	if err != nil {
+		return nil, err
+	}
+	doc, pageURL, err := c.get(ctx, PageSearch, "/?"+url.Values{"p": {section}, "search": {query}}.Encode())
+	if err != nil {
+		return nil, err
+	}
+	return parseSearch(doc, pageURL), nil
+}
+
+var (
+	yearPattern  = regexp.MustCompile(`\b(19[0-9]{2}|20[0-9]{2})\b`)
+	titleYear    = regexp.MustCompile(`\s*\((19[0-9]{2}|20[0-9]{2})\)\s*$`)
+	sizePattern  = regexp.MustCompile(`(?i)\b(\d+(?:[.,]\d+)?)\s*(To|Go|Mo|Ko|TB|GB|MB|KB)\b`)
+	sizeMultiple = map[string]float64{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+)
+
+// parseSearch extracts the results of a search page. Each result is a "cover_global" block with
+// the title link in "cover_infos_title" and the quality and language, in bold, in "detail_release".
+func parseSearch(doc *html.Node, pageURL *url.URL) []Result {
+	results := []Result{}
+	for _, block := range findAll(doc, byClass("cover_global")) {
+		titleBlock := find(block, byClass("cover_infos_title"))
+		if titleBlock == nil {
+			continue
+		}
+		link := find(titleBlock, byTag("a"))
+		if link == nil || attr(link, "href") == "" {
+			continue
+		}
+		r := Result{Title: text(link), DetailURL: absolute(pageURL, attr(link, "href"))}
+		if m := titleYear.FindStringSubmatch(r.Title); m != nil {
+			r.Year, _ = strconv.Atoi(m[1])
+			r.Title = strings.TrimSpace(r.Title[:len(r.Title)-len(m[0])])
+		}
+
+		_, r.Season = ParseSeason(r.Title)
+
+		if release := find(block, byClass("detail_release")); release != nil {
+			r.Quality, r.Language = parseVersion(release)
+		}
+		if img := find(block, byTag("img")); img != nil {
+			if src := attr(img, "src"); src != "" {
+				r.PosterURL = absolute(pageURL, src)
+			}
+		}
+
+		// The year and size, when shown, are in the rest of the block.
+		rest := strings.Replace(text(block), text(titleBlock), "", 1)
+		if r.Year == 0 {
+			if m := yearPattern.FindStringSubmatch(rest); m != nil {
+				r.Year, _ = strconv.Atoi(m[1])
+			}
+		}
+		r.Size = parseSize(rest)
+		results = append(results, r)
+	}
+	return results
+}
+
+// parseVersion reads a "detail_release" element, or a link to another version, such as <b>BLU-RAY 1080p</b> <b>(MULTI)</b>:
+// the quality, then the language in parentheses.
+func parseVersion(n *html.Node) (quality, language string) {
+	for _, b := range findAll(n, byTag("b")) {
+		value := text(b)
+		if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+			if language == "" {
+				language = strings.TrimSpace(value[1 : len(value)-1])
+			}
+		} else if quality == "" {
+			quality = value
+		}
+	}
+	if quality == "" && language == "" {
+		// Older pages have no bold parts: "BLU-RAY 1080p (MULTI)".
+		value := text(n)
+		if i := strings.LastIndex(value, "("); i >= 0 && strings.HasSuffix(value, ")") {
+			quality, language = strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:len(value)-1])
+		} else {
+			quality = value
+		}
+	}
+	return quality, language
+}
+
+// parseSize reads the first size in s, such as "1.4 Go" or "700 MB", in bytes; 0 when there is none.
+func parseSize(s string) int64 {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(value * sizeMultiple[strings.ToLower(m[2][:1])])
+}
+
+// absolute resolves a link found on a page against the page's URL.
+func absolute(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
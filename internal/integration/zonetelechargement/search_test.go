@@ -0,0 +1,124 @@
+package zonetelechargement
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const testSite = "https://www.zone-telechargement.example"
+
+// parseFixture parses testdata/name as if it had been fetched from ref on testSite.
+func parseFixture(t *testing.T, name, ref string) (*html.Node, *url.URL) {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := html.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageURL, err := url.Parse(testSite + ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc, pageURL
+}
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []Result
+	}{
+		{
+			fixture: "search_movies.html",
+			want: []Result{
+				{
+					Title:     "Dune : Deuxième partie",
+					Year:      2024,
+					Quality:   "BLU-RAY 1080p",
+					Language:  "MULTI",
+					Size:      15676630630,
+					PosterURL: testSite + "/img/films/dune-deuxieme-partie.jpg",
+					DetailURL: testSite + "/?p=film&id=31412-dune-deuxieme-partie",
+				},
+				{
+					Title:     "Dune",
+					Year:      1984,
+					Quality:   "DVDRIP",
+					Language:  "VOSTFR",
+					Size:      700 << 20,
+					PosterURL: "https://img.example/dune-1984.jpg",
+					DetailURL: testSite + "/?p=film&id=9876-dune",
+				},
+				{
+					Title:     "Dune, les origines",
+					DetailURL: testSite + "/?p=film&id=555-dune-les-origines",
+				},
+			},
+		},
+		{
+			fixture: "search_series.html",
+			want: []Result{
+				{
+					Title:     "The Bear - Saison 3",
+					Season:    3,
+					Year:      2024,
+					Quality:   "WEB-DL 1080p",
+					Language:  "VOSTFR",
+					Size:      3 << 29,
+					PosterURL: testSite + "/img/series/the-bear-s3.jpg",
+					DetailURL: testSite + "/?p=serie&id=4521-the-bear-saison-3",
+				},
+				{
+					Title:     "The Bear - Saison 1",
+					Season:    1,
+					Quality:   "HDTV 720p",
+					Language:  "FRENCH",
+					PosterURL: testSite + "/img/series/the-bear-s1.jpg",
+					DetailURL: testSite + "/?p=serie&id=3120-the-bear-saison-1",
+				},
+			},
+		},
+		{fixture: "search_empty.html", want: []Result{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			doc, pageURL := parseFixture(t, tt.fixture, "/?p=films&search=dune")
+			got := parseSearch(doc, pageURL)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d results, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("result %d:\n got %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"Taille : 1.4 Go", 1503238553},
+		{"1,5 Go par épisode", 3 << 29},
+		{"700 MB", 700 << 20},
+		{"2 To", 2 << 40},
+		{"512 Ko", 512 << 10},
+		{"10 épisodes", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseSize(tt.in); got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package zonetelechargement
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	seasonPattern  = regexp.MustCompile(`(?i)^(.*?)[\s\-–:]*\b(?:saison|season)\s*(\d{1,3})\b`)
+	episodePattern = regexp.MustCompile(`(?i)(?:\bS\d{1,3}\s*E|[ée]pisode\s*|\bEp\.?\s*|\bE)(\d{1,4})\b`)
+)
+
+// ParseSeason splits a series title such as "Breaking Bad - Saison 5" into the show and the
+// season. It returns the title and 0 when the title names no season.
+func ParseSeason(title string) (show string, season int) {
+	m := seasonPattern.FindStringSubmatch(title)
+	if m == nil {
+		return title, 0
+	}
+	season, _ = strconv.Atoi(m[2])
+	show = strings.TrimSpace(m[1])
+	if show == "" {
+		show = title
+	}
+	return show, season
+}
+
+// ParseEpisode reads the episode number in a link label such as "Episode 3", "Épisode 12" or
+// "S05E03"; 0 when there is none.
+func ParseEpisode(label string) int {
+	m := episodePattern.FindStringSubmatch(label)
+	if m == nil {
+		return 0
+	}
+	episode, _ := strconv.Atoi(m[1])
+	return episode
+}
+
+// Episodes returns one link per episode of a version at a hoster, in episode order. A version
+// whose episodes are spread over several pages is listed by several groups with the same quality
+// and language: the episodes of all of them are gathered, the first link found for an episode
+// winning.
+func (r *Release) Episodes(version LinkGroup, hoster string) []Link {
+	seen := map[int]bool{}
+	var episodes []Link
+	for _, group := range r.Groups {
+		if !strings.EqualFold(group.Quality, version.Quality) || !strings.EqualFold(group.Language, version.Language) {
+			continue
+		}
+		for _, h := range group.Hosters {
+			if !strings.EqualFold(h.Hoster, hoster) {
+				continue
+			}
+			for _, link := range h.Links {
+				if link.Episode > 0 && !seen[link.Episode] {
+					seen[link.Episode] = true
+					episodes = append(episodes, link)
+				}
+			}
+		}
+	}
+	sort.Slice(episodes, func(i, j int) bool { return episodes[i].Episode < episodes[j].Episode })
+	return episodes
+}
+
+// MissingEpisodes returns the episode numbers missing from links, in order: those below the
+// highest one listed that have no link. A season whose last episodes are missing cannot be told
+// from a shorter season.
+func MissingEpisodes(links []Link) []int {
+	listed := map[int]bool{}
+	last := 0
+	for _, link := range links {
+		listed[link.Episode] = true
+		last = max(last, link.Episode)
+	}
+	missing := []int{}
+	for episode := 1; episode < last; episode++ {
+		if !listed[episode] {
+			missing = append(missing, episode)
+		}
+	}
+	return missing
+}
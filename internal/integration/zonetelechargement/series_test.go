@@ -0,0 +1,93 @@
+package zonetelechargement
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSeason(t *testing.T) {
+	tests := []struct {
+		title  string
+		show   string
+		season int
+	}{
+		{"Breaking Bad - Saison 5", "Breaking Bad", 5},
+		{"The Bear – Saison 3", "The Bear", 3},
+		{"Dark: Season 2", "Dark", 2},
+		{"Les Revenants Saison 12", "Les Revenants", 12},
+		{"saison 1", "saison 1", 1},
+		{"Oppenheimer", "Oppenheimer", 0},
+		{"Saisons de la vie", "Saisons de la vie", 0},
+	}
+	for _, tt := range tests {
+		show, season := ParseSeason(tt.title)
+		if show != tt.show || season != tt.season {
+			t.Errorf("ParseSeason(%q) = %q, %d; want %q, %d", tt.title, show, season, tt.show, tt.season)
+		}
+	}
+}
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		label string
+		want  int
+	}{
+		{"Episode 3", 3},
+		{"Épisode 12", 12},
+		{"épisode 7 FINAL", 7},
+		{"S05E03", 3},
+		{"S1 E10", 10},
+		{"Ep. 4", 4},
+		{"E08", 8},
+		{"Partie 2", 0},
+		{"Télécharger", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseEpisode(tt.label); got != tt.want {
+			t.Errorf("ParseEpisode(%q) = %d, want %d", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestEpisodes(t *testing.T) {
+	release := &Release{Groups: []LinkGroup{
+		{Quality: "WEB-DL 1080p", Language: "VOSTFR", Hosters: []HosterLinks{
+			{Hoster: "1fichier", Links: []Link{{URL: "a3", Episode: 3}, {URL: "a1", Episode: 1}}},
+			{Hoster: "Uptobox", Links: []Link{{URL: "u2", Episode: 2}}},
+		}},
+		{Quality: "HDTV 720p", Language: "VOSTFR", Hosters: []HosterLinks{
+			{Hoster: "1fichier", Links: []Link{{URL: "h2", Episode: 2}}},
+		}},
+		// The second page of the 1080p version.
+		{Quality: "web-dl 1080p", Language: "vostfr", Hosters: []HosterLinks{
+			{Hoster: "1FICHIER", Links: []Link{{URL: "b3", Episode: 3}, {URL: "b5", Episode: 5}, {URL: "b0"}}},
+		}},
+	}}
+	got := release.Episodes(release.Groups[0], "1fichier")
+	want := []Link{{URL: "a1", Episode: 1}, {URL: "a3", Episode: 3}, {URL: "b5", Episode: 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Episodes = %+v, want %+v", got, want)
+	}
+}
+
+func TestMissingEpisodes(t *testing.T) {
+	tests := []struct {
+		episodes []int
+		want     []int
+	}{
+		{[]int{1, 2, 3}, []int{}},
+		{[]int{1, 2, 4, 7}, []int{3, 5, 6}},
+		{[]int{3}, []int{1, 2}},
+		{nil, []int{}},
+	}
+	for _, tt := range tests {
+		var links []Link
+		for _, episode := range tt.episodes {
+			links = append(links, Link{Episode: episode})
+		}
+		if got := MissingEpisodes(links); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MissingEpisodes(%v) = %v, want %v", tt.episodes, got, tt.want)
+		}
+	}
+}
@@ -15,25 +15,94 @@ type DownloadStatus string
 
 const (
 	StatusPending     DownloadStatus = "pending"
+	StatusQueued      DownloadStatus = "queued" // back in the queue after a resume or retry
 	StatusDownloading DownloadStatus = "downloading"
+	StatusPaused      DownloadStatus = "paused"
 	StatusCompleted   DownloadStatus = "completed"
+	StatusCancelled   DownloadStatus = "cancelled"
 	StatusError       DownloadStatus = "error"
 )
 
+// Download destinations.
+const (
+	DestinationLocal      = "local"      // transferred to the target path on disk
+	DestinationOneFichier = "onefichier" // remote-uploaded into the 1fichier account
+)
+
 type Download struct {
 	ID             int            `json:"id" db:"id"`
 	URL            string         `json:"url" db:"url"`
 	Filename       *string        `json:"filename,omitempty" db:"filename"`
 	CustomFilename *string        `json:"custom_filename,omitempty" db:"custom_filename"`
 	TargetPath     *string        `json:"target_path,omitempty" db:"target_path"`
+	PackageID      *int           `json:"package_id,omitempty" db:"package_id"`
+	Destination    string         `json:"destination" db:"destination"`
+	RemoteFolderID *int           `json:"remote_folder_id,omitempty" db:"remote_folder_id"` // 1fichier folder, root when nil
+	RemoteID       *int           `json:"remote_id,omitempty" db:"remote_id"`               // 1fichier remote upload request
+	Password       *string        `json:"-" db:"password"`                                  // unlocks password-protected hoster files
+	Show           *string        `json:"show,omitempty" db:"show"`                         // series the file is an episode of
+	Season         *int           `json:"season,omitempty" db:"season"`
+	Episode        *int           `json:"episode,omitempty" db:"episode"`
 	Status         DownloadStatus `json:"status" db:"status"`
+	Priority       int            `json:"priority" db:"priority"`
 	Progress       int            `json:"progress" db:"progress"`
 	Size           *int64         `json:"size,omitempty" db:"size"`
+	Downloaded     int64          `json:"downloaded" db:"downloaded"`
+	Segments       int            `json:"segments" db:"segments"`
+	SpeedLimit     *int64         `json:"speed_limit,omitempty" db:"speed_limit"`
+	Checksum       *string        `json:"checksum,omitempty" db:"checksum"`   // expected, as "algo:hex"
+	FileHash       *string        `json:"file_hash,omitempty" db:"file_hash"` // sha256 of the completed file
 	Speed          *int           `json:"speed,omitempty" db:"speed"`
 	ETA            *int           `json:"eta,omitempty" db:"eta"`
 	Error          *string        `json:"error,omitempty" db:"error"`
+	ErrorCode      *string        `json:"error_code,omitempty" db:"error_code"`
+	Attempts       int            `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	StartAt        *time.Time     `json:"start_at,omitempty" db:"start_at"`
 	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
 	UpdatedAt      *time.Time     `json:"updated_at,omitempty" db:"updated_at"`
+
+	// Headers, Cookies and the basic-auth credentials are sent with requests for plain HTTP links.
+	// They may hold secrets and are never returned.
+	Headers      map[string]string `json:"-" db:"headers"`
+	Cookies      map[string]string `json:"-" db:"cookies"`
+	AuthUsername *string           `json:"-" db:"auth_username"`
+	AuthPassword *string           `json:"-" db:"auth_password"`
+
+	// QueuePosition is the 1-based place of a waiting download in the queue. It is computed, not stored.
+	QueuePosition *int `json:"queue_position,omitempty" db:"-"`
+	// ScheduledFor is when a waiting download will become eligible to start, because of its
+	// start_at or the active hours window. Computed, and omitted when nothing holds it back.
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty" db:"-"`
+}
+
+// Package groups downloads queued together, such as the files of a folder or the parts of a release.
+type Package struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// The fields below are aggregated over the package's downloads.
+	Files      int   `json:"files" db:"-"`
+	Completed  int   `json:"completed" db:"-"`
+	Failed     int   `json:"failed" db:"-"`
+	Size       int64 `json:"size" db:"-"` // of the files whose size is known
+	Downloaded int64 `json:"downloaded" db:"-"`
+}
+
+// Credential is a saved login for a host reached over FTP or SFTP. Secrets are never returned.
+type Credential struct {
+	ID       int    `json:"id" db:"id"`
+	Protocol string `json:"protocol" db:"protocol"` // "ftp" or "sftp"
+	// Host is a hostname, matching any port, or host:port to match only that port.
+	Host       string `json:"host" db:"host"`
+	Username   string `json:"username" db:"username"`
+	Password   string `json:"-" db:"password"`
+	PrivateKey string `json:"-" db:"private_key"` // PEM-encoded, SFTP only
+	// HostKey pins the SFTP server's key, in authorized_keys format. When empty, the key seen on
+	// the first connection is saved here.
+	HostKey   string    `json:"host_key,omitempty" db:"host_key"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 type Session struct {